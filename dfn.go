@@ -0,0 +1,343 @@
+package main
+
+import "fmt"
+
+const (
+	// leftName and rightName are the names of the left and right arguments
+	// of a user-defined function.
+	leftName  = "⍺"
+	rightName = "⍵"
+	// selfName is the name a user-defined function calls itself with.
+	selfName = "∇"
+)
+
+// maxCalls is the maximum number of nested calls of user-defined functions,
+// it stops a function that recurses forever.
+const maxCalls = 1 << 14
+
+// scope holds the local variables of a call of a user-defined function.
+// Its parent is the scope the function was defined in, a nil scope holds the
+// global variables. Its depth is the number of calls nested up to this one.
+type scope struct {
+	vars   map[string]Value
+	parent *scope
+	depth  int
+}
+
+// level returns the number of nested calls the scope 's' belongs to, 0 for
+// the global variables.
+func (s *scope) level() int {
+	if s == nil {
+		return 0
+	}
+	return s.depth
+}
+
+// lookup returns the value of the variable 'name' found in the scope 's' or
+// in its parents, the global variables come last.
+func (s *scope) lookup(name string) (Value, bool) {
+	for ; s != nil; s = s.parent {
+		if val, ok := s.vars[name]; ok {
+			return val, true
+		}
+	}
+	val, ok := stack[name]
+	return val, ok
+}
+
+// set stores the value of the variable 'name' in the scope 's', in the
+// global variables if 's' is nil.
+func (s *scope) set(name string, val Value) {
+	if s == nil {
+		stack[name] = val
+		return
+	}
+	s.vars[name] = val
+}
+
+// Primitive represents a built-in function used as the operand of an
+// operator.
+// example +/ 1 2 3
+type Primitive string
+
+// String returns the name of the built-in function.
+func (f Primitive) String() string {
+	return string(f)
+}
+
+// Evaluate returns the built-in function.
+func (f Primitive) Evaluate() (Value, error) {
+	return f, nil
+}
+
+// Dfn represents a user-defined function, statements separated by '⋄' in
+// braces. The first statement that is not an assignment gives the result of
+// the function, a guard 'condition: expression' gives the result of the
+// function only when the condition is 1.
+// The right argument is '⍵', the left argument is '⍺' and the function
+// calls itself as '∇'.
+// Whether a name in the body is a function or an array is known when the
+// function is called, names holds what they were when the body was parsed.
+// example avg = {(+/⍵) / dim ⍵}
+// example fact = {⍵ <= 1: 1 ⋄ ⍵ * ∇ ⍵ - 1}
+type Dfn struct {
+	Body   []Expression
+	src    string
+	names  map[string]bool
+	scope  *scope
+	caller *scope
+}
+
+// String returns the source of a user-defined function.
+func (d Dfn) String() string {
+	return d.src
+}
+
+// Evaluate returns the function, that holds the scope it is defined in and
+// the scope it is called from.
+func (d Dfn) Evaluate() (Value, error) {
+	return d, nil
+}
+
+// call returns the result of the function applied to 'right', and to 'left'
+// if it is not nil.
+// Each call has its own scope for the arguments and for the variables
+// assigned by the statements.
+// Errors are reported at the position of the call.
+// The calls are counted along each chain of nested calls, so that the
+// functions applied in parallel by an operator do not add up.
+func (d Dfn) call(left, right Value) (Value, error) {
+	depth := d.caller.level() + 1
+	if depth > maxCalls {
+		return nil, newError(LimitError, selfName, "too many nested calls")
+	}
+
+	s := &scope{vars: map[string]Value{rightName: right, selfName: d}, parent: d.scope, depth: depth}
+	if left != nil {
+		s.vars[leftName] = left
+	}
+	body := d.Body
+	if d.stale(s) {
+		var err error
+		if body, err = parseBody(d, s); err != nil {
+			if e, ok := err.(*APLError); ok {
+				e.Pos = NoPos
+			}
+			return nil, err
+		}
+	}
+	var val Value
+	for _, stmt := range body {
+		stmt = bind(stmt, s)
+		v, err := stmt.Evaluate()
+		if err != nil {
+			if e, ok := err.(*APLError); ok {
+				e.Pos = NoPos
+			}
+			return nil, err
+		}
+		switch stmt.(type) {
+		case Guard:
+			if v != nil {
+				return v, nil
+			}
+		case Assignment, IndexAssign:
+			val = v
+		default:
+			return v, nil
+		}
+	}
+	if val == nil {
+		return nil, newError(ValueError, "", "function has no result")
+	}
+	return val, nil
+}
+
+// stale determines if a name the body of the function was parsed with has
+// become a function or stopped being one in the scope 's' of a call.
+func (d Dfn) stale(s *scope) bool {
+	for name, fn := range d.names {
+		v, _ := s.lookup(name)
+		if _, ok := v.(Dfn); ok != fn {
+			return true
+		}
+	}
+	return false
+}
+
+// Guard represents a statement of a user-defined function that gives the
+// result of the function when its condition is 1.
+// example ⍵ <= 1: 1
+type Guard struct {
+	Cond Expression
+	Val  Expression
+	pos  Pos
+}
+
+// String returns the string representation of a guard.
+func (g Guard) String() string {
+	return fmt.Sprintf("%v: %v", g.Cond, g.Val)
+}
+
+// Evaluate returns the value of the expression if the value of the condition
+// is 1, nil if it is 0.
+func (g Guard) Evaluate() (Value, error) {
+	c, err := g.Cond.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	if data := ravel(c); len(data) == 1 && (data[0] == Int(0) || data[0] == Int(1)) {
+		if data[0] == Int(0) {
+			return nil, nil
+		}
+		return g.Val.Evaluate()
+	}
+	return nil, atPos(newError(DomainError, "", "condition must be 0 or 1"), g.pos)
+}
+
+// Call represents the application of a user-defined function to the
+// expression on its right, and to the expression on its left if there is
+// one.
+// example avg 1 2 3
+// example 1 {⍺ + ⍵} 2
+type Call struct {
+	Fn    Expression
+	Left  Expression
+	Right Expression
+	pos   Pos
+}
+
+// String returns the string representation of a call.
+func (c Call) String() string {
+	if c.Left == nil {
+		return fmt.Sprintf("%v %v", c.Fn, c.Right)
+	}
+	return fmt.Sprintf("%v %v %v", c.Left, c.Fn, c.Right)
+}
+
+// Evaluate returns the value of the function applied to the values of the
+// expressions.
+// As in APL the right expression is evaluated first.
+func (c Call) Evaluate() (Value, error) {
+	right, err := c.Right.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	left, err := evaluate(c.Left)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.Fn.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := f.(Dfn)
+	if !ok {
+		return nil, atPos(newError(SyntaxError, "", "%v is not a function", c.Fn), c.pos)
+	}
+	val, err := d.call(left, right)
+	return val, atPos(err, c.pos)
+}
+
+// monadicOf returns the function 'f' used monadically, nil if 'f' is not a
+// function.
+func monadicOf(f Value) func(Value) (Value, error) {
+	switch f := f.(type) {
+	case Primitive:
+		return unary(string(f))
+	case Dfn:
+		return func(a Value) (Value, error) {
+			return f.call(nil, a)
+		}
+	}
+	return nil
+}
+
+// dyadicOf returns the function 'f' used dyadically, nil if 'f' is not a
+// function.
+func dyadicOf(f Value) func(Value, Value) (Value, error) {
+	switch f := f.(type) {
+	case Primitive:
+		return dyadic(string(f))
+	case Dfn:
+		return func(a, b Value) (Value, error) {
+			return f.call(a, b)
+		}
+	}
+	return nil
+}
+
+// function returns the value of the expression 'expr' that is the operand
+// of the operator 'name', a SYNTAX ERROR if it is not a function.
+func function(name string, expr Expression) (Value, error) {
+	f, err := expr.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	switch f.(type) {
+	case Primitive, Dfn:
+		return f, nil
+	}
+	return nil, newError(SyntaxError, name, "%v is not a function", expr)
+}
+
+// bind returns a copy of the expression 'expr' where the variables are
+// those of the scope 's' and the functions defined in it close over 's'.
+// The body of a function is bound when the function is called.
+func bind(expr Expression, s *scope) Expression {
+	switch x := expr.(type) {
+	case Variable:
+		x.scope = s
+		return x
+	case Assignment:
+		x.scope, x.Val = s, bind(x.Val, s)
+		return x
+	case IndexAssign:
+		x.Index, x.Val = bind(x.Index, s).(Index), bind(x.Val, s)
+		return x
+	case Index:
+		x.Val = bind(x.Val, s)
+		subs := make([]Subscript, len(x.Subs))
+		for i, sub := range x.Subs {
+			sub.Expr, sub.From, sub.To = bind(sub.Expr, s), bind(sub.From, s), bind(sub.To, s)
+			subs[i] = sub
+		}
+		x.Subs = subs
+		return x
+	case Strand:
+		items := make(Strand, len(x))
+		for i := range x {
+			items[i] = bind(x[i], s)
+		}
+		return items
+	case Unary:
+		x.Val = bind(x.Val, s)
+		return x
+	case Binary:
+		x.Left, x.Right = bind(x.Left, s), bind(x.Right, s)
+		return x
+	case Reduce:
+		x.Func, x.Axis, x.Val = bind(x.Func, s), bind(x.Axis, s), bind(x.Val, s)
+		return x
+	case Outer:
+		x.Func, x.Left, x.Right = bind(x.Func, s), bind(x.Left, s), bind(x.Right, s)
+		return x
+	case Inner:
+		x.F, x.G = bind(x.F, s), bind(x.G, s)
+		x.Left, x.Right = bind(x.Left, s), bind(x.Right, s)
+		return x
+	case Each:
+		x.Func, x.Left, x.Right = bind(x.Func, s), bind(x.Left, s), bind(x.Right, s)
+		return x
+	case Call:
+		x.Fn, x.Left, x.Right = bind(x.Fn, s), bind(x.Left, s), bind(x.Right, s)
+		return x
+	case Guard:
+		x.Cond, x.Val = bind(x.Cond, s), bind(x.Val, s)
+		return x
+	case Dfn:
+		x.scope, x.caller = s, s
+		return x
+	}
+	return expr
+}
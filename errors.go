@@ -0,0 +1,76 @@
+package main
+
+import "fmt"
+
+// ErrorClass represents the class of an APL error.
+type ErrorClass int
+
+const (
+	// SyntaxError represents an ill-formed expression
+	SyntaxError ErrorClass = iota
+	// ValueError represents the use of a name that has no value
+	ValueError
+	// DomainError represents an argument of the wrong type or out of the
+	// domain of a function such as a division by zero
+	DomainError
+	// LengthError represents arguments of mismatched lengths
+	LengthError
+	// RankError represents arguments of mismatched or unsupported ranks
+	RankError
+	// IndexError represents an index out of range
+	IndexError
+	// LimitError represents a result beyond the limits of the interpreter
+	LimitError
+)
+
+var errorClasses = [...]string{
+	SyntaxError: "SYNTAX ERROR",
+	ValueError:  "VALUE ERROR",
+	DomainError: "DOMAIN ERROR",
+	LengthError: "LENGTH ERROR",
+	RankError:   "RANK ERROR",
+	IndexError:  "INDEX ERROR",
+	LimitError:  "LIMIT ERROR",
+}
+
+// String returns the string representation of an error class.
+func (c ErrorClass) String() string {
+	return errorClasses[c]
+}
+
+// APLError represents an APL error raised while parsing or evaluating an
+// expression.
+type APLError struct {
+	Class ErrorClass
+	Func  string // name of the failing function, if any
+	Pos   Pos    // position of the offending token
+	Msg   string
+}
+
+// Error returns the string representation of an APL error.
+// example LENGTH ERROR: +: vectors of length 3 and 2
+func (e *APLError) Error() string {
+	s := e.Class.String()
+	if e.Func != "" {
+		s += ": " + e.Func
+	}
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	return s
+}
+
+// newError returns a new error of the given class raised by the function fn.
+// The position is set later by the expression that evaluates fn.
+func newError(class ErrorClass, fn string, format string, a ...interface{}) *APLError {
+	return &APLError{Class: class, Func: fn, Pos: NoPos, Msg: fmt.Sprintf(format, a...)}
+}
+
+// atPos sets the position of err to pos if err is an APL error that has
+// no position yet and returns it.
+func atPos(err error, pos Pos) error {
+	if e, ok := err.(*APLError); ok && !e.Pos.IsValid() {
+		e.Pos = pos
+	}
+	return err
+}
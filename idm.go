@@ -3,7 +3,9 @@ package main // package github.com/santiaago/idm
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -13,19 +15,90 @@ func init() {
 	log.SetFlags(log.Ltime | log.Ldate | log.Lshortfile)
 }
 
+// usage: idm [-single] [-threshold n] [script]
+// without a script idm reads expressions from the standard input.
+// -single evaluates everything on a single goroutine, -threshold sets the
+// number of items above which the work on an array runs in parallel, 0 runs
+// the work on any array in parallel.
 func main() {
+	flag.BoolVar(&singleThread, "single", singleThread, "evaluate on a single goroutine")
+	flag.IntVar(&parallelThreshold, "threshold", parallelThreshold, "number of items above which arrays are processed in parallel")
+	flag.Parse()
+	if parallelThreshold < 0 {
+		log.Fatalf("threshold must not be negative, got %v", parallelThreshold)
+	}
+
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		run(f, flag.Arg(0))
+		return
+	}
+	run(os.Stdin, "")
+}
+
+// run evaluates each line read from r and prints its value.
+// name is the name of the script being run, it is empty when reading from
+// the standard input.
+func run(r io.Reader, name string) {
+	prompt := func() {
+		if name == "" {
+			fmt.Printf("\t") // human lines start at tab. machine lines are without tab
+		}
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Printf("\t") // human lines start at tab. machine lines are without tab
-	for scanner.Scan() {
+	scanner := bufio.NewScanner(r)
+	prompt()
+	for n := 1; scanner.Scan(); n++ {
 		s := scanner.Text()
 		expr, err := NewParser(strings.NewReader(s)).Parse()
 		if err != nil {
-			fmt.Println(err)
-			fmt.Printf("\t")
+			printError(name, n, s, err)
+			prompt()
 			continue
 		}
-		fmt.Printf("%+v\n", (*expr).Evaluate())
-		fmt.Printf("\t")
+		v, err := (*expr).Evaluate()
+		if err != nil {
+			printError(name, n, s, err)
+			prompt()
+			continue
+		}
+		fmt.Printf("%+v\n", v)
+		prompt()
 	}
 }
+
+// printError prints the error and, if it has a position, the line with a
+// caret under the offending token.
+// When running a script the error is prefixed by the script name, the line
+// number n and the column of the offending token.
+// example
+// LENGTH ERROR: +: vectors of length 3 and 2
+//
+//	1 2 3 + 1 2
+//	      ^
+func printError(name string, n int, line string, err error) {
+	e, ok := err.(*APLError)
+	if !ok || !e.Pos.IsValid() || e.Pos.Offset > len(line) {
+		if name != "" {
+			fmt.Printf("%v:%v: ", name, n)
+		}
+		fmt.Println(err)
+		return
+	}
+	if name != "" {
+		fmt.Printf("%v:%v:%v: ", name, n+e.Pos.Line-1, e.Pos.Column)
+	}
+	fmt.Println(err)
+	// keep the tabs of the line so the caret is aligned with the token.
+	caret := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, line[:e.Pos.Offset])
+	fmt.Printf("\t%v\n\t%v^\n", line, caret)
+}
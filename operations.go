@@ -1,194 +1,1446 @@
 package main
 
 import (
-	"fmt"
 	"math"
+	"math/big"
+	"math/cmplx"
 )
 
-// times performs a 'a' + 'b' operation and returns it.
-func add(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(a.(Int) + b.(Int))
+// Ranks of the number types, a number is promoted to the type of higher
+// rank when it is combined with another number.
+const (
+	intRank = iota
+	bigIntRank
+	rationalRank
+	floatRank
+	complexRank
+)
+
+// numberRank returns the promotion rank of the number 'v' or -1 if 'v' is
+// not a number.
+func numberRank(v Value) int {
+	switch v.(type) {
+	case Int:
+		return intRank
+	case BigInt:
+		return bigIntRank
+	case Rational:
+		return rationalRank
+	case Float:
+		return floatRank
+	case Complex:
+		return complexRank
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, add(a.(Vector)[i], b.(Vector)[i]))
-		}
+	return -1
+}
+
+// isNumber determines if the value passed as param is a number.
+func isNumber(v Value) bool {
+	return numberRank(v) >= 0
+}
+
+// convert converts the number 'v' to the type of the given rank.
+// 'v' must have a lower or equal rank.
+func convert(v Value, rank int) Value {
+	if numberRank(v) == rank {
 		return v
 	}
-	fmt.Println("ERROR add: case not supported")
-	return nil
+	switch rank {
+	case bigIntRank:
+		return BigInt{big.NewInt(int64(v.(Int)))}
+	case rationalRank:
+		switch v := v.(type) {
+		case Int:
+			return Rational{new(big.Rat).SetInt64(int64(v))}
+		case BigInt:
+			return Rational{new(big.Rat).SetInt(v.x)}
+		}
+	case floatRank:
+		switch v := v.(type) {
+		case Int:
+			return Float(v)
+		case BigInt:
+			f, _ := new(big.Float).SetInt(v.x).Float64()
+			return Float(f)
+		case Rational:
+			f, _ := v.x.Float64()
+			return Float(f)
+		}
+	case complexRank:
+		return Complex(complex(float64(convert(v, floatRank).(Float)), 0))
+	}
+	return v
 }
 
-// times performs a 'a' - 'b' operation and returns it.
-func minus(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(a.(Int) - b.(Int))
+// promote converts the numbers 'a' and 'b' to a common type and returns them.
+// The number with the lower rank is converted to the type of the other one:
+// Int -> BigInt -> Rational -> Float -> Complex
+// Values that are not numbers are returned unchanged.
+func promote(a, b Value) (Value, Value) {
+	ra, rb := numberRank(a), numberRank(b)
+	if ra < 0 || rb < 0 {
+		return a, b
+	}
+	if ra < rb {
+		return convert(a, rb), b
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, minus(a.(Vector)[i], b.(Vector)[i]))
+	return a, convert(b, ra)
+}
+
+// compare returns -1, 0 or +1 depending on whether the number 'a' is less
+// than, equal to or greater than the number 'b'.
+// 'a' and 'b' must have been promoted to the same type and can not be
+// complex numbers as they are not ordered.
+func compare(a, b Value) int {
+	switch a := a.(type) {
+	case Int:
+		if a < b.(Int) {
+			return -1
+		} else if a > b.(Int) {
+			return 1
 		}
-		return v
+		return 0
+	case BigInt:
+		return a.x.Cmp(b.(BigInt).x)
+	case Rational:
+		return a.x.Cmp(b.(Rational).x)
+	case Float:
+		if a < b.(Float) {
+			return -1
+		} else if a > b.(Float) {
+			return 1
+		}
+		return 0
 	}
-	fmt.Println("ERROR minus: case not supported")
-	return nil
+	return 0
+}
+
+// pervade applies the scalar function 'fn' between the numbers of 'a' and 'b'
+// and returns the result.
+// A scalar is extended to the shape of the array on the other side and two
+// arrays must have the same shape.
+// example 1 2 3 + 1
+// 2 3 4
+func pervade(name string, a, b Value, fn func(a, b Value) (Value, error)) (Value, error) {
+	return elementwise(name, a, b, func(a, b Value) (Value, error) {
+		if !isNumber(a) || !isNumber(b) {
+			return nil, newError(DomainError, name, "arguments must be numbers")
+		}
+		return fn(a, b)
+	})
 }
 
-// times performs a 'a' / 'b' operation and returns it.
-func divide(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(a.(Int) / b.(Int))
+// elementwise applies the scalar function 'fn' between the simple scalars of
+// 'a' and 'b' as pervade does, whatever their type.
+func elementwise(name string, a, b Value, fn func(a, b Value) (Value, error)) (Value, error) {
+	if r, ok := applyPacked(name, a, b); ok {
+		return r, nil
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, divide(a.(Vector)[i], b.(Vector)[i]))
+	as, bs := shapeOf(a), shapeOf(b)
+	if len(as) == 0 && len(bs) == 0 {
+		if _, ok := a.(Box); ok {
+			r, err := elementwise(name, open(a), open(b), fn)
+			return box(r), err
 		}
-		return v
+		if _, ok := b.(Box); ok {
+			r, err := elementwise(name, a, open(b), fn)
+			return box(r), err
+		}
+		return fn(a, b)
 	}
-	fmt.Println("ERROR divide: case not supported")
-	return nil
+	if err := conform(name, as, bs); err != nil {
+		return nil, err
+	}
+
+	shape, ad, bd := as, ravel(a), ravel(b)
+	if len(as) == 0 {
+		shape = bs
+	}
+	v := make(Vector, size(shape))
+	err := forEach(len(v), func(i int) error {
+		x, y := a, b
+		if len(as) > 0 {
+			x = ad[i]
+		}
+		if len(bs) > 0 {
+			y = bd[i]
+		}
+		r, err := elementwise(name, x, y, fn)
+		v[i] = r
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newArray(shape, v), nil
 }
 
-// times performs a 'a' * 'b' operation and returns it.
-func times(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(a.(Int) * b.(Int))
+// conform returns an error unless the arrays of shape 'as' and 'bs' have
+// the same shape or one of them is a scalar.
+func conform(name string, as, bs []int) error {
+	if len(as) == 0 || len(bs) == 0 {
+		return nil
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, times(a.(Vector)[i], b.(Vector)[i]))
+	if len(as) != len(bs) {
+		return newError(RankError, name, "arrays of rank %v and %v", len(as), len(bs))
+	}
+	if !equalShapes(as, bs) {
+		if len(as) == 1 {
+			return newError(LengthError, name, "vectors of length %v and %v", as[0], bs[0])
 		}
-		return v
+		return newError(LengthError, name, "arrays of shape %v and %v", as, bs)
 	}
-	fmt.Println("ERROR times: case not supported")
 	return nil
 }
 
+// equalShapes determines if the shapes passed as param are the same.
+func equalShapes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// size returns the number of items of an array of the given shape.
+func size(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// add performs a 'a' + 'b' operation and returns it.
+// An Int that overflows is promoted to a BigInt.
+func add(a, b Value) (Value, error) {
+	return pervade("+", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		switch a := a.(type) {
+		case Int:
+			c := a + b.(Int)
+			if (c > a) != (b.(Int) > 0) {
+				return add(convert(a, bigIntRank), b)
+			}
+			return c, nil
+		case BigInt:
+			return bigIntValue(new(big.Int).Add(a.x, b.(BigInt).x)), nil
+		case Rational:
+			return ratValue(new(big.Rat).Add(a.x, b.(Rational).x)), nil
+		case Float:
+			return a + b.(Float), nil
+		case Complex:
+			return complexValue(complex128(a + b.(Complex))), nil
+		}
+		return nil, newError(DomainError, "+", "case not supported")
+	})
+}
+
+// minus performs a 'a' - 'b' operation and returns it.
+// An Int that overflows is promoted to a BigInt.
+func minus(a, b Value) (Value, error) {
+	return pervade("-", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		switch a := a.(type) {
+		case Int:
+			c := a - b.(Int)
+			if (c < a) != (b.(Int) > 0) {
+				return minus(convert(a, bigIntRank), b)
+			}
+			return c, nil
+		case BigInt:
+			return bigIntValue(new(big.Int).Sub(a.x, b.(BigInt).x)), nil
+		case Rational:
+			return ratValue(new(big.Rat).Sub(a.x, b.(Rational).x)), nil
+		case Float:
+			return a - b.(Float), nil
+		case Complex:
+			return complexValue(complex128(a - b.(Complex))), nil
+		}
+		return nil, newError(DomainError, "-", "case not supported")
+	})
+}
+
+// divide performs a 'a' / 'b' operation and returns it.
+// The division of two integers is exact, it is an integer when 'b' divides
+// 'a' and a rational otherwise.
+// example 6 / 3
+// 2
+// example 1 / 3
+// 1/3
+func divide(a, b Value) (Value, error) {
+	return pervade("/", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		if isZero(b) {
+			return nil, newError(DomainError, "/", "division by zero")
+		}
+		switch a := a.(type) {
+		case Int:
+			return ratValue(big.NewRat(int64(a), int64(b.(Int)))), nil
+		case BigInt:
+			return ratValue(new(big.Rat).SetFrac(a.x, b.(BigInt).x)), nil
+		case Rational:
+			return ratValue(new(big.Rat).Quo(a.x, b.(Rational).x)), nil
+		case Float:
+			return a / b.(Float), nil
+		case Complex:
+			return complexValue(complex128(a / b.(Complex))), nil
+		}
+		return nil, newError(DomainError, "/", "case not supported")
+	})
+}
+
+// times performs a 'a' * 'b' operation and returns it.
+// An Int that overflows is promoted to a BigInt.
+func times(a, b Value) (Value, error) {
+	return pervade("*", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		switch a := a.(type) {
+		case Int:
+			c := a * b.(Int)
+			if a != 0 && (c/a != b.(Int) || (a == -1 && b.(Int) == math.MinInt64)) {
+				return times(convert(a, bigIntRank), b)
+			}
+			return c, nil
+		case BigInt:
+			return bigIntValue(new(big.Int).Mul(a.x, b.(BigInt).x)), nil
+		case Rational:
+			return ratValue(new(big.Rat).Mul(a.x, b.(Rational).x)), nil
+		case Float:
+			return a * b.(Float), nil
+		case Complex:
+			return complexValue(complex128(a * b.(Complex))), nil
+		}
+		return nil, newError(DomainError, "*", "case not supported")
+	})
+}
+
 // pow performs a 'a' ** 'b' operation and returns it.
-func pow(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(math.Pow(float64(a.(Int)), float64(b.(Int))))
+// The power of an integer or a rational to an integer is exact.
+// The power of a negative number to a fraction is a complex number.
+// example 2 ** 100
+// 1267650600228229401496703205376
+// example 2 ** -1
+// 1/2
+func pow(a, b Value) (Value, error) {
+	return pervade("**", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		switch a := a.(type) {
+		case Int, BigInt:
+			return powRat(convert(a, rationalRank).(Rational).x, convert(b, rationalRank).(Rational).x)
+		case Rational:
+			return powRat(a.x, b.(Rational).x)
+		case Float:
+			if a < 0 && b.(Float) != Float(math.Trunc(float64(b.(Float)))) {
+				return pow(convert(a, complexRank), convert(b, complexRank))
+			}
+			if a == 0 && b.(Float) < 0 {
+				return nil, newError(DomainError, "**", "division by zero")
+			}
+			return Float(math.Pow(float64(a), float64(b.(Float)))), nil
+		case Complex:
+			if a == 0 && real(b.(Complex)) < 0 {
+				return nil, newError(DomainError, "**", "division by zero")
+			}
+			return complexValue(powComplex(complex128(a), complex128(b.(Complex)))), nil
+		}
+		return nil, newError(DomainError, "**", "case not supported")
+	})
+}
+
+// maxBits is the maximum size in bits of the numerator or the denominator of
+// an exact power.
+const maxBits = 1 << 24
+
+// powRat performs a 'a' ** 'b' operation on rationals and returns it.
+// The result is exact when 'b' is an integer and a float otherwise.
+func powRat(a, b *big.Rat) (Value, error) {
+	if !b.IsInt() || !b.Num().IsInt64() {
+		return pow(convert(Rational{a}, floatRank), convert(Rational{b}, floatRank))
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, pow(a.(Vector)[i], b.(Vector)[i]))
+	e := b.Num().Int64()
+	if e < 0 {
+		if a.Sign() == 0 {
+			return nil, newError(DomainError, "**", "division by zero")
 		}
-		return v
+		a, e = new(big.Rat).Inv(a), -e
 	}
-	fmt.Println("ERROR pow: case not supported")
-	return nil
+	bits := a.Num().BitLen()
+	if d := a.Denom().BitLen(); d > bits {
+		bits = d
+	}
+	if n := int64(bits - 1); n > 0 && e > maxBits/n {
+		return nil, newError(LimitError, "**", "result is too large")
+	}
+	num := new(big.Int).Exp(a.Num(), big.NewInt(e), nil)
+	den := new(big.Int).Exp(a.Denom(), big.NewInt(e), nil)
+	return ratValue(new(big.Rat).SetFrac(num, den)), nil
 }
 
-// max performs the maximum value between 'a' and 'b' and returns it.
-func max(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(math.Max(float64(a.(Int)), float64(b.(Int))))
+// powComplex performs a 'a' ** 'b' operation on complex numbers and returns
+// it. Integer powers are computed by repeated squaring to stay exact on
+// integer parts.
+func powComplex(a, b complex128) complex128 {
+	e := real(b)
+	if imag(b) != 0 || e != math.Trunc(e) || math.Abs(e) > 1<<31 {
+		return cmplx.Pow(a, b)
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, max(a.(Vector)[i], b.(Vector)[i]))
+	if e < 0 {
+		a, e = 1/a, -e
+	}
+	r := complex128(1)
+	for n := int64(e); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			r *= a
 		}
-		return v
+		a *= a
 	}
-	fmt.Println("ERROR max: case not supported")
-	return nil
+	return r
+}
+
+// max performs the maximum value between 'a' and 'b' and returns it.
+func max(a, b Value) (Value, error) {
+	return pervade("max", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		if _, ok := a.(Complex); ok {
+			return nil, newError(DomainError, "max", "complex numbers are not ordered")
+		}
+		if compare(a, b) < 0 {
+			return b, nil
+		}
+		return a, nil
+	})
 }
 
 // min performs the minimum value between 'a' and 'b' and returns it.
-func min(a, b Value) Value {
-	if _, ok := a.(Int); ok {
-		return Int(math.Min(float64(a.(Int)), float64(b.(Int))))
+func min(a, b Value) (Value, error) {
+	return pervade("min", a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		if _, ok := a.(Complex); ok {
+			return nil, newError(DomainError, "min", "complex numbers are not ordered")
+		}
+		if compare(a, b) > 0 {
+			return b, nil
+		}
+		return a, nil
+	})
+}
+
+// boolValue returns 1 if b is true and 0 otherwise.
+func boolValue(b bool) Value {
+	if b {
+		return Int(1)
 	}
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = append(v, min(a.(Vector)[i], b.(Vector)[i]))
+	return Int(0)
+}
+
+// isBool determines if the value is one of the numbers 0 or 1.
+func isBool(v Value) bool {
+	return isNumber(v) && (match(v, Int(0)) || match(v, Int(1)))
+}
+
+// equal returns 1 where the items of 'a' and 'b' are equal and 0 otherwise.
+// Items of any type can be compared, a number is never equal to a character.
+// example 1 2 3 == 1 5 3
+// 1 0 1
+func equal(a, b Value) (Value, error) {
+	return elementwise("==", a, b, func(a, b Value) (Value, error) {
+		return boolValue(match(a, b)), nil
+	})
+}
+
+// notEqual returns 1 where the items of 'a' and 'b' are different and 0
+// otherwise.
+// example 1 2 3 != 1 5 3
+// 0 1 0
+func notEqual(a, b Value) (Value, error) {
+	return elementwise("!=", a, b, func(a, b Value) (Value, error) {
+		return boolValue(!match(a, b)), nil
+	})
+}
+
+// less returns 1 where the items of 'a' are less than the items of 'b'.
+// example 1 2 3 < 2
+// 1 0 0
+func less(a, b Value) (Value, error) {
+	return order("<", a, b, func(c int) bool { return c < 0 })
+}
+
+// lessEqual returns 1 where the items of 'a' are less than or equal to the
+// items of 'b'.
+func lessEqual(a, b Value) (Value, error) {
+	return order("<=", a, b, func(c int) bool { return c <= 0 })
+}
+
+// greater returns 1 where the items of 'a' are greater than the items of 'b'.
+func greater(a, b Value) (Value, error) {
+	return order(">", a, b, func(c int) bool { return c > 0 })
+}
+
+// greaterEqual returns 1 where the items of 'a' are greater than or equal to
+// the items of 'b'.
+func greaterEqual(a, b Value) (Value, error) {
+	return order(">=", a, b, func(c int) bool { return c >= 0 })
+}
+
+// order compares the numbers of 'a' and 'b' and returns 1 where 'test' holds
+// for the result of the comparison and 0 otherwise.
+func order(name string, a, b Value, test func(int) bool) (Value, error) {
+	return pervade(name, a, b, func(a, b Value) (Value, error) {
+		a, b = promote(a, b)
+		if _, ok := a.(Complex); ok {
+			return nil, newError(DomainError, name, "complex numbers are not ordered")
 		}
-		return v
+		return boolValue(test(compare(a, b))), nil
+	})
+}
+
+// and returns the logical and of the booleans 'a' and 'b'.
+// example 1 1 0 1 and 1 0 1 1
+// 1 0 0 1
+func and(a, b Value) (Value, error) {
+	return logic("and", a, b, func(x, y bool) bool { return x && y })
+}
+
+// or returns the logical or of the booleans 'a' and 'b'.
+// example 1 1 0 1 or 1 0 1 1
+// 1 1 1 1
+func or(a, b Value) (Value, error) {
+	return logic("or", a, b, func(x, y bool) bool { return x || y })
+}
+
+// nand returns the negation of the logical and of the booleans 'a' and 'b'.
+func nand(a, b Value) (Value, error) {
+	return logic("nand", a, b, func(x, y bool) bool { return !(x && y) })
+}
+
+// nor returns the negation of the logical or of the booleans 'a' and 'b'.
+func nor(a, b Value) (Value, error) {
+	return logic("nor", a, b, func(x, y bool) bool { return !(x || y) })
+}
+
+// logic applies the logical function 'fn' between the booleans of 'a' and
+// 'b', any other item is a domain error.
+func logic(name string, a, b Value, fn func(x, y bool) bool) (Value, error) {
+	return elementwise(name, a, b, func(a, b Value) (Value, error) {
+		if !isBool(a) || !isBool(b) {
+			return nil, newError(DomainError, name, "arguments must be booleans")
+		}
+		return boolValue(fn(match(a, Int(1)), match(b, Int(1)))), nil
+	})
+}
+
+// not returns the logical negation of the booleans of 'a'. <not>
+// example not 1 0 1
+// 0 1 0
+func not(a Value) (Value, error) {
+	return monadic("not", a, func(a Value) (Value, error) {
+		if !isBool(a) {
+			return nil, newError(DomainError, "not", "argument must be a boolean")
+		}
+		return boolValue(!match(a, Int(1))), nil
+	})
+}
+
+// identities holds the identity elements of the dyadic functions, that is
+// the result of their reduction over an empty array.
+var identities = map[string]Value{
+	"+":   Int(0),
+	"-":   Int(0),
+	"*":   Int(1),
+	"/":   Int(1),
+	"**":  Int(1),
+	"max": Float(math.Inf(-1)),
+	"min": Float(math.Inf(1)),
+	"==":  Int(1),
+	"!=":  Int(0),
+	"<":   Int(0),
+	"<=":  Int(1),
+	">":   Int(0),
+	">=":  Int(1),
+	"and": Int(1),
+	"or":  Int(0),
+}
+
+// associative holds the dyadic functions for which (a f b) f c is the same
+// as a f (b f c), their scans can be computed in a single pass.
+var associative = map[string]bool{
+	"+":   true,
+	"*":   true,
+	"max": true,
+	"min": true,
+	"and": true,
+	"or":  true,
+}
+
+// axisOf returns the 0 based axis of 'a' given by 'axis' in the index origin,
+// the last axis if 'axis' is nil.
+func axisOf(name string, a, axis Value) (int, error) {
+	rank := len(shapeOf(a))
+	if axis == nil {
+		return rank - 1, nil
 	}
-	fmt.Println("ERROR min: case not supported")
-	return nil
+	x, ok := axis.(Int)
+	if !ok {
+		return 0, newError(DomainError, name, "axis must be an integer")
+	}
+	k := int(x) - indexOrigin()
+	if k < 0 || k >= rank {
+		return 0, newError(IndexError, name, "axis %v out of range", x)
+	}
+	return k, nil
 }
 
-// sum performs the sum of all items of 'a'. <+/>
-// if 'a' is a vector, it is the sum of the vector items.
-func sum(a Value) Value {
-	if _, ok := a.(Int); ok {
-		return a.(Int)
+// reduce inserts the dyadic function 'fn' named 'fname' between the items of
+// 'a' along the axis 'k' and returns the result. <f/>
+// As in APL the reduction is evaluated from right to left, the reduction of
+// an empty axis is the identity element of the function.
+// example -/ 1 2 3
+// 2
+// example +/[1] 2 3 shape iota 6
+// 5 7 9
+func reduce(name, fname string, fn func(a, b Value) (Value, error), a Value, k int) (Value, error) {
+	shape := shapeOf(a)
+	if len(shape) == 0 {
+		return a, nil
 	}
-	if _, ok := a.(Vector); ok {
-		var v Value
-		v = Int(0)
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = add(v, a.(Vector)[i])
+	if r, ok := reducePacked(fname, a, k, false); ok {
+		return r, nil
+	}
+	n, outer, inner := shape[k], size(shape[:k]), size(shape[k+1:])
+	id, ok := identities[fname]
+	if n == 0 && !ok {
+		return nil, newError(DomainError, name, "%v has no identity element", fname)
+	}
+
+	data := ravel(a)
+	v := make(Vector, 0, outer*inner)
+	for o := 0; o < outer; o++ {
+		for i := 0; i < inner; i++ {
+			if n == 0 {
+				v = append(v, id)
+				continue
+			}
+			r, err := fold(fn, data, (o*n)*inner+i, inner, n)
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, r)
 		}
-		return v
 	}
-	fmt.Println("ERROR sum: case not supported")
-	return nil
+	rshape := append(append([]int(nil), shape[:k]...), shape[k+1:]...)
+	return newArray(rshape, v), nil
 }
 
-// scanSum performs the scan sum of the all the items of 'a'. <+\>
-// if 'a' is a vector, the result of scanSum is a vector with the
-// cumulative sum of the previous items.
+// scan returns the reductions by the dyadic function 'fn' of the prefixes of
+// the items of 'a' along the axis 'k'. <f\>
+// The scan of an associative function reuses the reduction of the previous
+// prefix, any other function reduces each prefix from right to left.
 // example +\ 1 2 3
 // 1 3 6
-func scanSum(a Value) Value {
-	if _, ok := a.(Int); ok {
-		return a.(Int)
+// example -\ 1 2 3
+// 1 -1 2
+func scan(name, fname string, fn func(a, b Value) (Value, error), a Value, k int) (Value, error) {
+	shape := shapeOf(a)
+	if len(shape) == 0 {
+		return a, nil
 	}
+	if r, ok := reducePacked(fname, a, k, true); ok {
+		return r, nil
+	}
+	n, outer, inner := shape[k], size(shape[:k]), size(shape[k+1:])
+	data := ravel(a)
+	v := make(Vector, len(data))
+	for o := 0; o < outer; o++ {
+		for i := 0; i < inner; i++ {
+			start := (o*n)*inner + i
+			if associative[fname] && n > 0 {
+				r := data[start]
+				v[start] = r
+				for j := 1; j < n; j++ {
+					var err error
+					if r, err = fn(r, data[start+j*inner]); err != nil {
+						return nil, err
+					}
+					v[start+j*inner] = box(r)
+				}
+				continue
+			}
+			for j := 0; j < n; j++ {
+				r, err := fold(fn, data, start, inner, j+1)
+				if err != nil {
+					return nil, err
+				}
+				v[start+j*inner] = r
+			}
+		}
+	}
+	return newArray(shape, v), nil
+}
 
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 1; i <= len(a.(Vector)); i++ {
-			v = append(v, sum(a.(Vector)[:i]))
+// fold reduces from right to left the 'n' items of data found from 'start'
+// every 'stride' items.
+func fold(fn func(a, b Value) (Value, error), data Vector, start, stride, n int) (Value, error) {
+	r := data[start+(n-1)*stride]
+	for j := n - 2; j >= 0; j-- {
+		var err error
+		if r, err = fn(data[start+j*stride], r); err != nil {
+			return nil, err
 		}
-		return v
 	}
-	return nil
+	return box(r), nil
 }
 
-// multiply performs the multiplication of all items of 'a'. <*/>
-// if 'a' is a vector, it is the multiplication of the vector items.
-func multiply(a Value) Value {
-	if _, ok := a.(Int); ok {
-		return a.(Int)
+// outer returns the outer product of 'a' and 'b' by the dyadic function
+// 'fn', that is 'fn' applied between each item of 'a' and each item of 'b'.
+// The shape of the result is the shape of 'a' followed by the shape of 'b'.
+// example (iota 3) ∘.* iota 4
+// 1 2 3 4
+// 2 4 6 8
+// 3 6 9 12
+func outer(name string, fn func(a, b Value) (Value, error), a, b Value) (Value, error) {
+	as, bs := shapeOf(a), shapeOf(b)
+	shape := append(append([]int(nil), as...), bs...)
+	ad, bd := ravel(a), ravel(b)
+	if len(as) == 0 {
+		ad = Vector{a}
+	}
+	if len(bs) == 0 {
+		bd = Vector{b}
+	}
+	n := size(shape)
+	if n > maxSize {
+		return nil, newError(LimitError, name, "array is too large")
 	}
-	if _, ok := a.(Vector); ok {
-		var v Value
-		v = Int(1)
-		for i := 0; i < len(a.(Vector)); i++ {
-			v = times(v, a.(Vector)[i])
+	v := make(Vector, n)
+	err := forEach(n, func(i int) error {
+		r, err := fn(open(ad[i/len(bd)]), open(bd[i%len(bd)]))
+		if err != nil {
+			return err
 		}
-		return v
+		v[i] = box(r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println("ERROR multiply: case not supported")
-	return nil
+	return newArray(shape, v), nil
 }
 
-// scanMultiply performs the scan multiplication of the all the items of 'a'. <*\>
-// if 'a' is a vector, the result of scanSum is a vector with the
-// cumulative sum of the previous items.
-// example *\ 1 2 3
-// 1 2 6
-func scanMultiply(a Value) Value {
-	if _, ok := a.(Int); ok {
-		return a.(Int)
+// inner returns the inner product of 'a' and 'b' by the dyadic functions
+// 'f' and 'g', that is the reduction by 'f' of 'g' applied between each
+// vector along the last axis of 'a' and each vector along the first axis of
+// 'b'. Those axes must have the same length, a scalar is extended.
+// The shape of the result is the shape of 'a' without its last axis
+// followed by the shape of 'b' without its first axis. The arguments may
+// have any rank, the errors of 'f' and 'g' are reported with their names.
+// example (2 2 shape 1 2 3 4) +.* 2 2 shape 5 6 7 8
+// 19 22
+// 43 50
+func inner(name, fname, gname string, f, g func(a, b Value) (Value, error), a, b Value) (Value, error) {
+	as, bs := shapeOf(a), shapeOf(b)
+	if len(as) > 0 && len(bs) > 0 && as[len(as)-1] != bs[0] {
+		if len(as) == 1 && len(bs) == 1 {
+			return nil, newError(LengthError, name, "vectors of length %v and %v", as[0], bs[0])
+		}
+		return nil, newError(LengthError, name, "arrays of shape %v and %v", as, bs)
+	}
+	if fname == "+" && gname == "*" && len(as) > 0 && len(bs) > 0 {
+		if r, ok := matmul(a, b); ok {
+			return r, nil
+		}
+	}
+
+	// a scalar is a vector of the length of the axis of the other argument.
+	ad, bd, n := ravel(a), ravel(b), 1
+	va, vb := len(as) > 0, len(bs) > 0
+	if va {
+		as, n = as[:len(as)-1], as[len(as)-1]
+	}
+	if vb {
+		bs, n = bs[1:], bs[0]
+	}
+	shape := append(append([]int(nil), as...), bs...)
+	rows, cols := size(as), size(bs)
+	if rows*cols > maxSize {
+		return nil, newError(LimitError, name, "array is too large")
 	}
 
-	if _, ok := a.(Vector); ok {
-		var v Vector
-		for i := 1; i <= len(a.(Vector)); i++ {
-			v = append(v, multiply(a.(Vector)[:i]))
+	v := make(Vector, rows*cols)
+	err := forEach(len(v), func(i int) error {
+		r, c := i/cols, i%cols
+		x, y := make(Vector, n), make(Vector, n)
+		for j := 0; j < n; j++ {
+			x[j], y[j] = a, b
+			if va {
+				x[j] = ad[r*n+j]
+			}
+			if vb {
+				y[j] = bd[j*cols+c]
+			}
 		}
-		return v
+		z, err := g(newArray([]int{n}, x), newArray([]int{n}, y))
+		if err != nil {
+			return err
+		}
+		if k := len(shapeOf(z)) - 1; k >= 0 {
+			if z, err = reduce(name, fname, f, z, k); err != nil {
+				return err
+			}
+		}
+		v[i] = box(z)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return newArray(shape, v), nil
+}
+
+// each returns the monadic function 'fn' applied to each item of 'a', the
+// results are the items of an array of the shape of 'a'. <f¨>
+// example dim¨ (1 2) (3 4 5)
+// (2) (3)
+func each(fn func(a Value) (Value, error), a Value) (Value, error) {
+	if len(shapeOf(a)) == 0 {
+		r, err := fn(open(a))
+		if err != nil {
+			return nil, err
+		}
+		return box(r), nil
+	}
+	data := ravel(a)
+	v := make(Vector, len(data))
+	err := forEach(len(data), func(i int) error {
+		r, err := fn(open(data[i]))
+		if err != nil {
+			return err
+		}
+		v[i] = box(r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newArray(shapeOf(a), v), nil
+}
+
+// eachPair returns the dyadic function 'fn' applied between each item of
+// 'a' and the matching item of 'b', a scalar is paired with every item of
+// the other argument. <f¨>
+// example 1 2 shape¨ 3 4
+// (3) (4 4)
+func eachPair(name string, fn func(a, b Value) (Value, error), a, b Value) (Value, error) {
+	as, bs := shapeOf(a), shapeOf(b)
+	if err := conform(name, as, bs); err != nil {
+		return nil, err
+	}
+	shape := as
+	if len(as) == 0 {
+		shape = bs
+	}
+	ad, bd := ravel(a), ravel(b)
+	v := make(Vector, size(shape))
+	err := forEach(len(v), func(i int) error {
+		x, y := a, b
+		if len(as) > 0 {
+			x = ad[i]
+		}
+		if len(bs) > 0 {
+			y = bd[i]
+		}
+		r, err := fn(open(x), open(y))
+		if err != nil {
+			return err
+		}
+		v[i] = box(r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newArray(shape, v), nil
+}
+
+// realPart returns the real part of 'a'. <real>
+// if 'a' is a vector, it is the real part of each item.
+func realPart(a Value) (Value, error) {
+	return monadic("real", a, func(x Value) (Value, error) {
+		if c, ok := x.(Complex); ok {
+			return Float(real(c)), nil
+		}
+		return x, nil
+	})
+}
+
+// imagPart returns the imaginary part of 'a'. <imag>
+// if 'a' is a vector, it is the imaginary part of each item.
+func imagPart(a Value) (Value, error) {
+	return monadic("imag", a, func(x Value) (Value, error) {
+		if c, ok := x.(Complex); ok {
+			return Float(imag(c)), nil
+		}
+		return Int(0), nil
+	})
+}
+
+// magnitude returns the magnitude, or absolute value, of 'a'. <mag>
+// if 'a' is a vector, it is the magnitude of each item.
+// example mag 3j4
+// 5
+func magnitude(a Value) (Value, error) {
+	return monadic("mag", a, func(x Value) (Value, error) {
+		if c, ok := x.(Complex); ok {
+			return Float(cmplx.Abs(complex128(c))), nil
+		}
+		if isNegative(x) {
+			return minus(Int(0), x)
+		}
+		return x, nil
+	})
+}
+
+// phase returns the phase, or argument, of 'a' in radians. <phase>
+// if 'a' is a vector, it is the phase of each item.
+func phase(a Value) (Value, error) {
+	return monadic("phase", a, func(x Value) (Value, error) {
+		if c, ok := x.(Complex); ok {
+			return Float(cmplx.Phase(complex128(c))), nil
+		}
+		if isNegative(x) {
+			return Float(math.Pi), nil
+		}
+		return Int(0), nil
+	})
+}
+
+// conjugate returns the complex conjugate of 'a'. <conj>
+// if 'a' is a vector, it is the conjugate of each item.
+// example conj 3j4
+// 3j-4
+func conjugate(a Value) (Value, error) {
+	return monadic("conj", a, func(x Value) (Value, error) {
+		if c, ok := x.(Complex); ok {
+			return Complex(cmplx.Conj(complex128(c))), nil
+		}
+		return x, nil
+	})
+}
+
+// isNegative determines if the real number passed as param is negative.
+func isNegative(x Value) bool {
+	x, zero := promote(x, Int(0))
+	return compare(x, zero) < 0
+}
+
+// isZero determines if the number passed as param is zero.
+func isZero(x Value) bool {
+	if c, ok := x.(Complex); ok {
+		return c == 0
+	}
+	x, zero := promote(x, Int(0))
+	return compare(x, zero) == 0
+}
+
+// monadic applies the function 'fn' to each number of 'a'.
+func monadic(name string, a Value, fn func(Value) (Value, error)) (Value, error) {
+	if isNumber(a) {
+		return fn(a)
+	}
+	if b, ok := a.(Box); ok {
+		r, err := monadic(name, b.v, fn)
+		return box(r), err
+	}
+	shape := shapeOf(a)
+	if len(shape) == 0 {
+		return nil, newError(DomainError, name, "argument must be a number")
+	}
+	data := ravel(a)
+	v := make(Vector, len(data))
+	err := forEach(len(data), func(i int) error {
+		r, err := monadic(name, data[i], fn)
+		v[i] = r
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newArray(shape, v), nil
+}
+
+// maxSize is the maximum number of items of an array.
+const maxSize = 1 << 28
+
+// reshape returns an array of shape 'a' with the items of 'b'. <shape>
+// The items of 'b' are repeated as many times as needed to fill the array.
+// example 2 3 shape 1 2
+// 1 2 1
+// 2 1 2
+func reshape(a, b Value) (Value, error) {
+	if len(shapeOf(a)) > 1 {
+		return nil, newError(RankError, "shape", "left argument must be a vector")
+	}
+	dims := ravel(a)
+	shape := make([]int, len(dims))
+	n := 1
+	for i, d := range dims {
+		d, ok := d.(Int)
+		if !ok || d < 0 {
+			return nil, newError(DomainError, "shape", "dimensions must be non-negative integers")
+		}
+		if d > 0 && n > maxSize/int(d) {
+			return nil, newError(LimitError, "shape", "array is too large")
+		}
+		shape[i] = int(d)
+		n *= int(d)
+	}
+
+	if v, ok := repeat(shape, n, b); ok {
+		return v, nil
+	}
+	items := ravel(b)
+	if n == 0 {
+		return emptyLike(shape, b), nil
+	}
+	if len(items) == 0 {
+		items = Vector{fill(b)}
+	}
+	data := make(Vector, n)
+	for i := range data {
+		data[i] = items[i%len(items)]
+	}
+	return newArray(shape, data), nil
+}
+
+// dim returns the shape of 'a'. <dim>
+// The shape of a scalar is an empty vector.
+// example dim 2 3 shape 1
+// 2 3
+func dim(a Value) (Value, error) {
+	shape := shapeOf(a)
+	v := make(Vector, len(shape))
+	for i, d := range shape {
+		v[i] = Int(d)
+	}
+	return newArray([]int{len(v)}, v), nil
+}
+
+// interval returns the vector of the first 'a' indices. <iota>
+// The first index is the index origin 'io'.
+// example iota 5
+// 1 2 3 4 5
+func interval(a Value) (Value, error) {
+	if len(shapeOf(a)) > 1 {
+		return nil, newError(RankError, "iota", "argument must be a scalar")
+	}
+	items := ravel(a)
+	if len(items) != 1 {
+		return nil, newError(LengthError, "iota", "argument must be a scalar")
+	}
+	n, ok := items[0].(Int)
+	if !ok || n < 0 {
+		return nil, newError(DomainError, "iota", "argument must be a non-negative integer")
+	}
+	if n > maxSize {
+		return nil, newError(LimitError, "iota", "vector is too large")
+	}
+	io := int64(indexOrigin())
+	v := make([]int64, n)
+	for i := range v {
+		v[i] = int64(i) + io
+	}
+	return newInts([]int{len(v)}, v), nil
+}
+
+// indexOf returns the index of the first occurrence of each item of 'b' in
+// the vector 'a'. <iota>
+// Items that are not found get the index following the last item of 'a'.
+// example 10 20 30 iota 30 10 5
+// 3 1 4
+func indexOf(a, b Value) (Value, error) {
+	if len(shapeOf(a)) > 1 {
+		return nil, newError(RankError, "iota", "left argument must be a vector")
+	}
+	io := indexOrigin()
+	if v, ok := indexPacked(a, b, io); ok {
+		return v, nil
+	}
+	haystack, needles := ravel(a), ravel(b)
+	v := make(Vector, len(needles))
+	for i, needle := range needles {
+		v[i] = Int(len(haystack) + io)
+		for j, item := range haystack {
+			if match(item, needle) {
+				v[i] = Int(j + io)
+				break
+			}
+		}
+	}
+	if len(shapeOf(b)) == 0 {
+		return v[0], nil
+	}
+	return newArray(shapeOf(b), v), nil
+}
+
+// match determines if the values 'a' and 'b' are identical, that is they have
+// the same shape and the same items.
+func match(a, b Value) bool {
+	if x, ok := a.(Box); ok {
+		y, ok := b.(Box)
+		return ok && match(x.v, y.v)
+	}
+	if _, ok := b.(Box); ok {
+		return false
+	}
+	if x, ok := a.(Char); ok {
+		return x == b
+	}
+	if _, ok := b.(Char); ok {
+		return false
+	}
+	if isNumber(a) && isNumber(b) {
+		a, b = promote(a, b)
+		if c, ok := a.(Complex); ok {
+			return c == b.(Complex)
+		}
+		return compare(a, b) == 0
+	}
+	if !equalShapes(shapeOf(a), shapeOf(b)) || isNumber(a) || isNumber(b) {
+		return false
+	}
+	ad, bd := ravel(a), ravel(b)
+	for i := range ad {
+		if !match(ad[i], bd[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// enclose returns 'a' as a scalar. <enclose>
+// A simple scalar is returned as it is.
+// example depth enclose 1 2 3
+// 2
+func enclose(a Value) (Value, error) {
+	if _, ok := a.(Box); !ok && len(shapeOf(a)) == 0 {
+		return a, nil
+	}
+	return Box{a}, nil
+}
+
+// disclose returns the enclosed array of 'a' if 'a' is a scalar. <disclose>
+// If 'a' is an array, its items are mixed into an array of higher rank where
+// the shape of 'a' is followed by the shape of the largest item. Smaller
+// items are padded with zeros, or spaces if the first item holds characters.
+// example disclose (1 2) (3 4 5)
+// 1 2 0
+// 3 4 5
+func disclose(a Value) (Value, error) {
+	shape := shapeOf(a)
+	if len(shape) == 0 {
+		return open(a), nil
+	}
+	items := ravel(a)
+	rank := 0
+	for _, x := range items {
+		if r := len(shapeOf(open(x))); r > rank {
+			rank = r
+		}
+	}
+	if rank == 0 {
+		return a, nil
+	}
+
+	// the shape of each item is extended with leading 1s to the same rank.
+	shapes := make([][]int, len(items))
+	inner := make([]int, rank)
+	for i, x := range items {
+		s := shapeOf(open(x))
+		shapes[i] = make([]int, rank)
+		for j := range shapes[i] {
+			shapes[i][j] = 1
+		}
+		copy(shapes[i][rank-len(s):], s)
+		for j, d := range shapes[i] {
+			if d > inner[j] {
+				inner[j] = d
+			}
+		}
+	}
+
+	rshape := append(append([]int(nil), shape...), inner...)
+	if size(rshape) > maxSize {
+		return nil, newError(LimitError, "disclose", "array of shape %v is too large", rshape)
+	}
+	strides := make([]int, rank)
+	for j, stride := rank-1, 1; j >= 0; j-- {
+		strides[j] = stride
+		stride *= inner[j]
+	}
+
+	n := size(inner)
+	v := make(Vector, size(rshape))
+	for i := range v {
+		v[i] = fill(items[0])
+	}
+	for i, x := range items {
+		for k, y := range ravel(open(x)) {
+			offset := 0
+			for j, rem := rank-1, k; j >= 0; j-- {
+				offset += rem % shapes[i][j] * strides[j]
+				rem /= shapes[i][j]
+			}
+			v[i*n+offset] = y
+		}
+	}
+	return newArray(rshape, v), nil
+}
+
+// fill returns the item used to pad an array like 'a', a space if 'a' holds
+// characters and 0 otherwise.
+func fill(a Value) Value {
+	if _, ok := open(a).(EmptyChars); ok {
+		return Char(' ')
+	}
+	if data := ravel(open(a)); len(data) > 0 {
+		if _, ok := data[0].(Char); ok {
+			return Char(' ')
+		}
+	}
+	return Int(0)
+}
+
+// first returns the first item of 'a', disclosed. <first>
+// The first item of an empty array is 0, or a space if it holds characters.
+// example first (1 2) 3
+// 1 2
+func first(a Value) (Value, error) {
+	if b, ok := a.(Box); ok {
+		return b.v, nil
+	}
+	data := ravel(a)
+	if len(data) == 0 {
+		return fill(a), nil
+	}
+	return open(data[0]), nil
+}
+
+// depth returns the level of nesting of 'a'. <depth>
+// A simple scalar has depth 0, an array of simple scalars has depth 1 and an
+// array holding arrays has a depth of one more than its deepest item.
+// example depth 1 (2 3)
+// 2
+func depth(a Value) (Value, error) {
+	return Int(depthOf(a)), nil
+}
+
+// depthOf returns the level of nesting of 'a'.
+func depthOf(a Value) int {
+	if b, ok := a.(Box); ok {
+		return 1 + depthOf(b.v)
+	}
+	if len(shapeOf(a)) == 0 {
+		return 0
+	}
+	d := 0
+	for _, x := range ravel(a) {
+		if n := depthOf(open(x)); n > d {
+			d = n
+		}
+	}
+	return 1 + d
+}
+
+// axis is an evaluated subscript of an index.
+type axis struct {
+	idx      Value // indices of the axis, nil for a slice
+	slice    bool
+	from, to Value // bounds of the slice, nil when omitted
+}
+
+// index returns the items of 'a' selected by the subscripts of each axis.
+// Indices start at the index origin 'io' and negative indices count from
+// the end, -1 being the last item. A slice 'from:to' is half-open, it
+// selects the 'to - from' items from the index 'from' up to the index 'to'
+// excluded, both counted from the index origin. In origin 0 it is a slice
+// of Python.
+// The shape of the result is made of the shapes of the indices.
+// example (10 20 30 40)[2]
+// 20
+// example (10 20 30 40)[-2:]
+// 30 40
+// example (10 20 30 40)[2:4]
+// 20 30
+// example (2 3 shape iota 6)[;2]
+// 2 5
+func index(a Value, axes []axis) (Value, error) {
+	offsets, shape, err := selection(shapeOf(a), axes)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) == 0 {
+		return emptyLike(shape, a), nil
+	}
+	if v, ok := gather(a, offsets, shape); ok {
+		return v, nil
+	}
+	data := ravel(a)
+	v := make(Vector, len(offsets))
+	for i, offset := range offsets {
+		v[i] = data[offset]
+	}
+	return newArray(shape, v), nil
+}
+
+// assign returns a copy of 'a' where the items selected by the subscripts
+// of each axis are replaced by the items of 'b'.
+// 'b' is either a scalar, extended to all the selected items, or has the
+// shape of the selection.
+// example (10 20 30 40)[2] = 0
+// 10 0 30 40
+func assign(a Value, axes []axis, b Value) (Value, error) {
+	offsets, shape, err := selection(shapeOf(a), axes)
+	if err != nil {
+		return nil, err
+	}
+	bs := shapeOf(b)
+	if len(bs) > 0 {
+		if len(bs) != len(shape) {
+			return nil, newError(RankError, "index", "arrays of rank %v and %v", len(shape), len(bs))
+		}
+		if !equalShapes(shape, bs) {
+			if len(bs) == 1 {
+				return nil, newError(LengthError, "index", "vectors of length %v and %v", shape[0], bs[0])
+			}
+			return nil, newError(LengthError, "index", "arrays of shape %v and %v", shape, bs)
+		}
+	}
+
+	// copy the items so that other variables holding 'a' are not modified.
+	if v, ok := scatter(a, offsets, b); ok {
+		return v, nil
+	}
+	data := append(Vector(nil), ravel(a)...)
+	bd := ravel(b)
+	for i, offset := range offsets {
+		if len(bs) > 0 {
+			data[offset] = bd[i]
+		} else {
+			data[offset] = b
+		}
+	}
+	return newArray(shapeOf(a), data), nil
+}
+
+// selection returns the offsets in row-major order of the items of an
+// array of shape 'shape' selected by the subscripts of each axis, and the
+// shape of the selection.
+func selection(shape []int, axes []axis) ([]int, []int, error) {
+	if len(shape) == 0 {
+		return nil, nil, newError(RankError, "index", "a scalar can not be indexed")
+	}
+	if len(axes) != len(shape) {
+		return nil, nil, newError(RankError, "index", "%v subscripts for an array of rank %v", len(axes), len(shape))
+	}
+
+	var rshape []int
+	positions := make([][]int, len(axes))
+	for k, ax := range axes {
+		n := shape[k]
+		if ax.slice {
+			from, err := bound(ax.from, 0, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			to, err := bound(ax.to, n, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			for j := from; j < to; j++ {
+				positions[k] = append(positions[k], j)
+			}
+			rshape = append(rshape, len(positions[k]))
+			continue
+		}
+		for _, i := range ravel(ax.idx) {
+			j, err := position(i, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			positions[k] = append(positions[k], j)
+		}
+		rshape = append(rshape, shapeOf(ax.idx)...)
+	}
+
+	strides := make([]int, len(shape))
+	for k, stride := len(shape)-1, 1; k >= 0; k-- {
+		strides[k] = stride
+		stride *= shape[k]
+	}
+
+	offsets := make([]int, 0, size(rshape))
+	counters := make([]int, len(positions))
+	for size(rshape) > 0 {
+		offset := 0
+		for k, c := range counters {
+			offset += positions[k][c] * strides[k]
+		}
+		offsets = append(offsets, offset)
+
+		// move to the next item in row-major order.
+		k := len(counters) - 1
+		for ; k >= 0; k-- {
+			if counters[k]++; counters[k] < len(positions[k]) {
+				break
+			}
+			counters[k] = 0
+		}
+		if k < 0 {
+			break
+		}
+	}
+	return offsets, rshape, nil
+}
+
+// position returns the 0 based position of the index 'i' in an axis of
+// length 'n'.
+func position(i Value, n int) (int, error) {
+	x, ok := i.(Int)
+	if !ok {
+		return 0, newError(DomainError, "index", "indices must be integers")
+	}
+	j := int(x) - indexOrigin()
+	if x < 0 {
+		j = n + int(x)
+	}
+	if j < 0 || j >= n {
+		return 0, newError(IndexError, "index", "%v out of range", x)
+	}
+	return j, nil
+}
+
+// bound returns the 0 based position of the bound 'b' of a slice in an axis
+// of length 'n', a positive bound is an index in the index origin and a
+// negative bound counts from the end.
+// If there is no bound it returns 'def'.
+func bound(b Value, def, n int) (int, error) {
+	if b == nil {
+		return def, nil
+	}
+	x, ok := b.(Int)
+	if !ok {
+		return 0, newError(DomainError, "index", "bounds must be integers")
+	}
+	j := int(x) - indexOrigin()
+	if x < 0 {
+		j = n + int(x)
+	}
+	if j < 0 || j > n {
+		return 0, newError(IndexError, "index", "bound %v out of range", x)
+	}
+	return j, nil
 }
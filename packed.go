@@ -0,0 +1,753 @@
+package main
+
+import "math"
+
+// Ints is a type to handle arrays of integers stored packed.
+type Ints struct {
+	shape []int
+	data  []int64
+}
+
+// String returns the string representation of an array of integers.
+func (a Ints) String() string {
+	return boxed(a).String()
+}
+
+// Evaluate returns the value of a given array of integers.
+func (a Ints) Evaluate() (Value, error) {
+	return a, nil
+}
+
+// Floats is a type to handle arrays of floats stored packed.
+type Floats struct {
+	shape []int
+	data  []float64
+}
+
+// String returns the string representation of an array of floats.
+func (a Floats) String() string {
+	return boxed(a).String()
+}
+
+// Evaluate returns the value of a given array of floats.
+func (a Floats) Evaluate() (Value, error) {
+	return a, nil
+}
+
+// Bools is a type to handle arrays of booleans, 0 and 1, stored packed.
+type Bools struct {
+	shape []int
+	data  []bool
+}
+
+// String returns the string representation of an array of booleans.
+func (a Bools) String() string {
+	return boxed(a).String()
+}
+
+// Evaluate returns the value of a given array of booleans.
+func (a Bools) Evaluate() (Value, error) {
+	return a, nil
+}
+
+// pack returns the items in data with the given shape stored packed, if the
+// items are all integers or all floats.
+// Integers that are all 0 or 1 are stored as booleans. Empty arrays are
+// never packed.
+func pack(shape []int, data Vector) (Value, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	switch data[0].(type) {
+	case Int:
+		ints := make([]int64, len(data))
+		for i := range data {
+			x, ok := data[i].(Int)
+			if !ok {
+				return nil, false
+			}
+			ints[i] = int64(x)
+		}
+		return newInts(shape, ints), true
+	case Float:
+		floats := make([]float64, len(data))
+		for i := range data {
+			x, ok := data[i].(Float)
+			if !ok {
+				return nil, false
+			}
+			floats[i] = float64(x)
+		}
+		return newFloats(shape, floats), true
+	}
+	return nil, false
+}
+
+// newInts returns the integers in data with the given shape, stored as
+// booleans if they are all 0 or 1.
+func newInts(shape []int, data []int64) Value {
+	if len(shape) == 0 {
+		return Int(data[0])
+	}
+	if len(data) == 0 {
+		return newArray(shape, Vector{})
+	}
+	bools := make([]bool, len(data))
+	for i, x := range data {
+		if x != 0 && x != 1 {
+			return Ints{shape: shape, data: data}
+		}
+		bools[i] = x == 1
+	}
+	return Bools{shape: shape, data: bools}
+}
+
+// newFloats returns the floats in data with the given shape.
+func newFloats(shape []int, data []float64) Value {
+	if len(shape) == 0 {
+		return Float(data[0])
+	}
+	if len(data) == 0 {
+		return newArray(shape, Vector{})
+	}
+	return Floats{shape: shape, data: data}
+}
+
+// newBools returns the booleans in data with the given shape.
+func newBools(shape []int, data []bool) Value {
+	if len(shape) == 0 {
+		return boolValue(data[0])
+	}
+	if len(data) == 0 {
+		return newArray(shape, Vector{})
+	}
+	return Bools{shape: shape, data: data}
+}
+
+// boxed returns the packed array 'a' as a vector or an array of values.
+// Any other value is returned as it is.
+func boxed(a Value) Value {
+	switch a.(type) {
+	case Ints, Floats, Bools:
+		shape := shapeOf(a)
+		if len(shape) == 1 {
+			return ravel(a)
+		}
+		return Array{shape: shape, data: ravel(a)}
+	}
+	return a
+}
+
+// kind is the type of the items of a packed array.
+type kind int
+
+const (
+	noKind kind = iota
+	boolKind
+	intKind
+	floatKind
+)
+
+// kindOf returns the type of the items of 'a' if 'a' is a packed array or a
+// scalar that can be combined with one.
+func kindOf(a Value) kind {
+	switch a := a.(type) {
+	case Bools:
+		return boolKind
+	case Ints:
+		return intKind
+	case Floats:
+		return floatKind
+	case Int:
+		if a == 0 || a == 1 {
+			return boolKind
+		}
+		return intKind
+	case Float:
+		return floatKind
+	}
+	return noKind
+}
+
+// intsOf returns the items of the packed array or scalar 'a' as integers.
+func intsOf(a Value) []int64 {
+	switch a := a.(type) {
+	case Ints:
+		return a.data
+	case Bools:
+		v := make([]int64, len(a.data))
+		for i, x := range a.data {
+			if x {
+				v[i] = 1
+			}
+		}
+		return v
+	case Int:
+		return []int64{int64(a)}
+	}
+	return nil
+}
+
+// floatsOf returns the items of the packed array or scalar 'a' as floats.
+func floatsOf(a Value) []float64 {
+	switch a := a.(type) {
+	case Floats:
+		return a.data
+	case Float:
+		return []float64{float64(a)}
+	}
+	ints := intsOf(a)
+	v := make([]float64, len(ints))
+	for i, x := range ints {
+		v[i] = float64(x)
+	}
+	return v
+}
+
+// boolsOf returns the items of the packed array or scalar 'a' as booleans.
+func boolsOf(a Value) []bool {
+	switch a := a.(type) {
+	case Bools:
+		return a.data
+	case Int:
+		return []bool{a == 1}
+	}
+	return nil
+}
+
+// kernel holds the loops of a scalar function over packed arrays, one for
+// each type of items. A nil loop means the function has no fast path for
+// that type. Loops return false when the result can not be computed with
+// the type, for example when an integer overflows.
+type kernel struct {
+	ints     func(x, y int64) (int64, bool)
+	floats   func(x, y float64) (float64, bool)
+	intCmp   func(x, y int64) bool
+	floatCmp func(x, y float64) bool
+	bools    func(x, y bool) bool
+}
+
+// kernels holds the loops over packed arrays of the dyadic scalar functions.
+var kernels = map[string]kernel{
+	"+": {
+		ints: func(x, y int64) (int64, bool) {
+			z := x + y
+			return z, (z > x) == (y > 0)
+		},
+		floats: func(x, y float64) (float64, bool) { return x + y, true },
+	},
+	"-": {
+		ints: func(x, y int64) (int64, bool) {
+			z := x - y
+			return z, (z < x) == (y > 0)
+		},
+		floats: func(x, y float64) (float64, bool) { return x - y, true },
+	},
+	"*": {
+		ints: func(x, y int64) (int64, bool) {
+			z := x * y
+			return z, x == 0 || (z/x == y && !(x == -1 && y == math.MinInt64))
+		},
+		floats: func(x, y float64) (float64, bool) { return x * y, true },
+	},
+	"/": {
+		floats: func(x, y float64) (float64, bool) { return x / y, y != 0 },
+	},
+	"max": {
+		ints:   func(x, y int64) (int64, bool) { return maxInt(x, y), true },
+		floats: func(x, y float64) (float64, bool) { return math.Max(x, y), true },
+	},
+	"min": {
+		ints:   func(x, y int64) (int64, bool) { return minInt(x, y), true },
+		floats: func(x, y float64) (float64, bool) { return math.Min(x, y), true },
+	},
+	"==": {
+		intCmp:   func(x, y int64) bool { return x == y },
+		floatCmp: func(x, y float64) bool { return x == y },
+		bools:    func(x, y bool) bool { return x == y },
+	},
+	"!=": {
+		intCmp:   func(x, y int64) bool { return x != y },
+		floatCmp: func(x, y float64) bool { return x != y },
+		bools:    func(x, y bool) bool { return x != y },
+	},
+	"<": {
+		intCmp:   func(x, y int64) bool { return x < y },
+		floatCmp: func(x, y float64) bool { return x < y },
+	},
+	"<=": {
+		intCmp:   func(x, y int64) bool { return x <= y },
+		floatCmp: func(x, y float64) bool { return x <= y },
+	},
+	">": {
+		intCmp:   func(x, y int64) bool { return x > y },
+		floatCmp: func(x, y float64) bool { return x > y },
+	},
+	">=": {
+		intCmp:   func(x, y int64) bool { return x >= y },
+		floatCmp: func(x, y float64) bool { return x >= y },
+	},
+	"and":  {bools: func(x, y bool) bool { return x && y }},
+	"or":   {bools: func(x, y bool) bool { return x || y }},
+	"nand": {bools: func(x, y bool) bool { return !(x && y) }},
+	"nor":  {bools: func(x, y bool) bool { return !(x || y) }},
+}
+
+// maxInt returns the maximum of two integers.
+func maxInt(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// minInt returns the minimum of two integers.
+func minInt(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// isPacked determines if 'a' is a packed array.
+func isPacked(a Value) bool {
+	switch a.(type) {
+	case Ints, Floats, Bools:
+		return true
+	}
+	return false
+}
+
+// applyPacked applies the dyadic scalar function 'name' between the items of
+// 'a' and 'b' with the loops of its kernel when at least one of them is a
+// packed array and the other one is a packed array of the same shape or a
+// number. It returns false when there is no fast path, the caller must
+// then compute the result item by item.
+func applyPacked(name string, a, b Value) (Value, bool) {
+	if !isPacked(a) && !isPacked(b) {
+		return nil, false
+	}
+	k, ok := kernels[name]
+	if !ok {
+		return nil, false
+	}
+	ka, kb := kindOf(a), kindOf(b)
+	if ka == noKind || kb == noKind {
+		return nil, false
+	}
+	as, bs := shapeOf(a), shapeOf(b)
+	shape := as
+	if len(as) == 0 {
+		shape = bs
+	} else if len(bs) > 0 && !equalShapes(as, bs) {
+		return nil, false
+	}
+	n := size(shape)
+	// a scalar is read at index 0 for all the items.
+	sa, sb := 1, 1
+	if len(as) == 0 {
+		sa = 0
+	}
+	if len(bs) == 0 {
+		sb = 0
+	}
+
+	switch {
+	case ka == boolKind && kb == boolKind && k.bools != nil:
+		x, y := boolsOf(a), boolsOf(b)
+		v := make([]bool, n)
+		ranges(n, parallelThreshold, func(lo, hi int) bool {
+			for i := lo; i < hi; i++ {
+				v[i] = k.bools(x[i*sa], y[i*sb])
+			}
+			return true
+		})
+		return newBools(shape, v), true
+	case ka != floatKind && kb != floatKind && k.ints != nil:
+		x, y := intsOf(a), intsOf(b)
+		v := make([]int64, n)
+		ok := ranges(n, parallelThreshold, func(lo, hi int) bool {
+			for i := lo; i < hi; i++ {
+				z, ok := k.ints(x[i*sa], y[i*sb])
+				if !ok {
+					return false
+				}
+				v[i] = z
+			}
+			return true
+		})
+		if !ok {
+			return nil, false
+		}
+		return newInts(shape, v), true
+	case ka != floatKind && kb != floatKind && k.intCmp != nil:
+		x, y := intsOf(a), intsOf(b)
+		v := make([]bool, n)
+		ranges(n, parallelThreshold, func(lo, hi int) bool {
+			for i := lo; i < hi; i++ {
+				v[i] = k.intCmp(x[i*sa], y[i*sb])
+			}
+			return true
+		})
+		return newBools(shape, v), true
+	case (ka == floatKind || kb == floatKind) && k.floats != nil:
+		x, y := floatsOf(a), floatsOf(b)
+		v := make([]float64, n)
+		ok := ranges(n, parallelThreshold, func(lo, hi int) bool {
+			for i := lo; i < hi; i++ {
+				z, ok := k.floats(x[i*sa], y[i*sb])
+				if !ok {
+					return false
+				}
+				v[i] = z
+			}
+			return true
+		})
+		if !ok {
+			return nil, false
+		}
+		return newFloats(shape, v), true
+	case (ka == floatKind || kb == floatKind) && k.floatCmp != nil:
+		x, y := floatsOf(a), floatsOf(b)
+		v := make([]bool, n)
+		ranges(n, parallelThreshold, func(lo, hi int) bool {
+			for i := lo; i < hi; i++ {
+				v[i] = k.floatCmp(x[i*sa], y[i*sb])
+			}
+			return true
+		})
+		return newBools(shape, v), true
+	}
+	return nil, false
+}
+
+// reducePacked reduces the packed array 'a' along the axis 'k' with the
+// kernel of the associative function 'name', or scans it if 'scan' is true.
+// It returns false when there is no fast path.
+func reducePacked(name string, a Value, k int, scan bool) (Value, bool) {
+	kn, ok := kernels[name]
+	if !ok || !associative[name] || !isPacked(a) {
+		return nil, false
+	}
+	shape := shapeOf(a)
+	n, outer, inner := shape[k], size(shape[:k]), size(shape[k+1:])
+	if n == 0 {
+		return nil, false
+	}
+	rshape := append(append([]int(nil), shape[:k]...), shape[k+1:]...)
+	if scan {
+		rshape = shape
+	}
+
+	// out returns the position in the result of the item 'j' of the axis
+	// that starts at 'start' in the cell 'c'.
+	out := func(c, start, j int) int {
+		if scan {
+			return start + j*inner
+		}
+		return c
+	}
+
+	// a long vector of integers is reduced by chunks and the partial
+	// results are then reduced in order.
+	if !scan && len(shape) == 1 && n > parallelThreshold && kindOf(a) != floatKind {
+		return reduceChunks(name, a)
+	}
+	// each chunk of cells holds about parallelThreshold items.
+	cells, cellSize := outer*inner, parallelThreshold/n
+
+	switch ka := kindOf(a); {
+	case ka == boolKind && kn.bools != nil:
+		x, v := boolsOf(a), make([]bool, size(rshape))
+		ranges(cells, cellSize, func(lo, hi int) bool {
+			for c := lo; c < hi; c++ {
+				start := c/inner*n*inner + c%inner
+				r := x[start]
+				v[out(c, start, 0)] = r
+				for j := 1; j < n; j++ {
+					r = kn.bools(r, x[start+j*inner])
+					v[out(c, start, j)] = r
+				}
+			}
+			return true
+		})
+		return newBools(rshape, v), true
+	case ka != floatKind && kn.ints != nil:
+		x, v := intsOf(a), make([]int64, size(rshape))
+		ok := ranges(cells, cellSize, func(lo, hi int) bool {
+			for c := lo; c < hi; c++ {
+				start := c/inner*n*inner + c%inner
+				r := x[start]
+				v[out(c, start, 0)] = r
+				for j := 1; j < n; j++ {
+					var ok bool
+					if r, ok = kn.ints(r, x[start+j*inner]); !ok {
+						return false
+					}
+					v[out(c, start, j)] = r
+				}
+			}
+			return true
+		})
+		if !ok {
+			return nil, false
+		}
+		return newInts(rshape, v), true
+	case ka == floatKind && kn.floats != nil && scan:
+		x, v := floatsOf(a), make([]float64, size(rshape))
+		ranges(cells, cellSize, func(lo, hi int) bool {
+			for c := lo; c < hi; c++ {
+				start := c/inner*n*inner + c%inner
+				r := x[start]
+				v[start] = r
+				for j := 1; j < n; j++ {
+					r, _ = kn.floats(r, x[start+j*inner])
+					v[start+j*inner] = r
+				}
+			}
+			return true
+		})
+		return newFloats(rshape, v), true
+	case ka == floatKind && kn.floats != nil:
+		// floats are rounded so they are reduced from right to left as
+		// fold does, for the result not to depend on how they are stored.
+		x, v := floatsOf(a), make([]float64, size(rshape))
+		ranges(cells, cellSize, func(lo, hi int) bool {
+			for c := lo; c < hi; c++ {
+				start := c/inner*n*inner + c%inner
+				r := x[start+(n-1)*inner]
+				for j := n - 2; j >= 0; j-- {
+					r, _ = kn.floats(x[start+j*inner], r)
+				}
+				v[c] = r
+			}
+			return true
+		})
+		return newFloats(rshape, v), true
+	}
+	return nil, false
+}
+
+// reduceChunks reduces the packed vector 'a' with the associative function
+// 'name' by chunks of parallelThreshold items, then reduces the results of
+// the chunks in order. Floats are not reduced by chunks as their rounding
+// depends on the order they are added in.
+// The chunks only depend on the length of 'a' so the result is the same
+// however many goroutines reduce them.
+func reduceChunks(name string, a Value) (Value, bool) {
+	kn := kernels[name]
+	n := shapeOf(a)[0]
+	count := chunkCount(n, parallelThreshold)
+
+	switch ka := kindOf(a); {
+	case ka == boolKind && kn.bools != nil:
+		x, partials := boolsOf(a), make([]bool, count)
+		chunks(n, parallelThreshold, func(c, lo, hi int) {
+			r := x[lo]
+			for i := lo + 1; i < hi; i++ {
+				r = kn.bools(r, x[i])
+			}
+			partials[c] = r
+		})
+		r := partials[0]
+		for _, p := range partials[1:] {
+			r = kn.bools(r, p)
+		}
+		return boolValue(r), true
+	case ka != floatKind && kn.ints != nil:
+		x, partials, oks := intsOf(a), make([]int64, count), make([]bool, count)
+		chunks(n, parallelThreshold, func(c, lo, hi int) {
+			r, ok := x[lo], true
+			for i := lo + 1; i < hi && ok; i++ {
+				r, ok = kn.ints(r, x[i])
+			}
+			partials[c], oks[c] = r, ok
+		})
+		r := partials[0]
+		for c, p := range partials {
+			ok := oks[c]
+			if ok && c > 0 {
+				r, ok = kn.ints(r, p)
+			}
+			if !ok {
+				return nil, false
+			}
+		}
+		return Int(r), true
+	}
+	return nil, false
+}
+
+// matmul returns the inner product +.* of the packed arrays 'a' and 'b', the
+// last axis of 'a' has the length of the first axis of 'b'.
+// It returns false when there is no fast path.
+func matmul(a, b Value) (Value, bool) {
+	if !isPacked(a) || !isPacked(b) {
+		return nil, false
+	}
+	as, bs := shapeOf(a), shapeOf(b)
+	n := bs[0]
+	rows, cols := size(as[:len(as)-1]), size(bs[1:])
+	shape := append(append([]int(nil), as[:len(as)-1]...), bs[1:]...)
+	if n == 0 || rows*cols == 0 {
+		return nil, false
+	}
+	// each chunk of rows holds about parallelThreshold products.
+	rowSize := parallelThreshold / (n * cols)
+
+	if kindOf(a) != floatKind && kindOf(b) != floatKind {
+		add, times := kernels["+"].ints, kernels["*"].ints
+		x, y, v := intsOf(a), intsOf(b), make([]int64, rows*cols)
+		ok := ranges(rows, rowSize, func(lo, hi int) bool {
+			for r := lo; r < hi; r++ {
+				row := v[r*cols : (r+1)*cols]
+				for j := 0; j < n; j++ {
+					for c := range row {
+						z, ok := times(x[r*n+j], y[j*cols+c])
+						if !ok {
+							return false
+						}
+						if row[c], ok = add(row[c], z); !ok {
+							return false
+						}
+					}
+				}
+			}
+			return true
+		})
+		if !ok {
+			return nil, false
+		}
+		return newInts(shape, v), true
+	}
+	// the products are summed from right to left as reduce does.
+	x, y, v := floatsOf(a), floatsOf(b), make([]float64, rows*cols)
+	ranges(rows, rowSize, func(lo, hi int) bool {
+		for r := lo; r < hi; r++ {
+			row := v[r*cols : (r+1)*cols]
+			for c := range row {
+				row[c] = x[r*n+n-1] * y[(n-1)*cols+c]
+			}
+			for j := n - 2; j >= 0; j-- {
+				for c := range row {
+					row[c] = x[r*n+j]*y[j*cols+c] + row[c]
+				}
+			}
+		}
+		return true
+	})
+	return newFloats(shape, v), true
+}
+
+// gather returns the items of the packed array 'a' at the given offsets of
+// its data, with the given shape.
+// It returns false when 'a' is not packed.
+func gather(a Value, offsets, shape []int) (Value, bool) {
+	switch a := a.(type) {
+	case Ints:
+		v := make([]int64, len(offsets))
+		for i, offset := range offsets {
+			v[i] = a.data[offset]
+		}
+		return newInts(shape, v), true
+	case Floats:
+		v := make([]float64, len(offsets))
+		for i, offset := range offsets {
+			v[i] = a.data[offset]
+		}
+		return newFloats(shape, v), true
+	case Bools:
+		v := make([]bool, len(offsets))
+		for i, offset := range offsets {
+			v[i] = a.data[offset]
+		}
+		return newBools(shape, v), true
+	}
+	return nil, false
+}
+
+// scatter returns a copy of the packed array 'a' where the items at the
+// given offsets of its data are replaced by the items of 'b', a number or a
+// packed array with one item per offset.
+// It returns false when the items of 'a' and 'b' can not be stored packed
+// together, integers and floats are not mixed.
+func scatter(a Value, offsets []int, b Value) (Value, bool) {
+	ka, kb := kindOf(a), kindOf(b)
+	if !isPacked(a) || kb == noKind {
+		return nil, false
+	}
+	shape := shapeOf(a)
+	switch {
+	case ka == boolKind && kb == boolKind:
+		v, items := append([]bool(nil), boolsOf(a)...), boolsOf(b)
+		for i, offset := range offsets {
+			v[offset] = items[i%len(items)]
+		}
+		return newBools(shape, v), true
+	case ka != floatKind && kb != floatKind:
+		v, items := append([]int64(nil), intsOf(a)...), intsOf(b)
+		for i, offset := range offsets {
+			v[offset] = items[i%len(items)]
+		}
+		return newInts(shape, v), true
+	case ka == floatKind && kb == floatKind:
+		v, items := append([]float64(nil), floatsOf(a)...), floatsOf(b)
+		for i, offset := range offsets {
+			v[offset] = items[i%len(items)]
+		}
+		return newFloats(shape, v), true
+	}
+	return nil, false
+}
+
+// repeat returns an array of the given shape with 'n' items, the items of
+// the packed array or number 'b' repeated as many times as needed.
+// It returns false when 'b' is neither packed nor a number that can be.
+func repeat(shape []int, n int, b Value) (Value, bool) {
+	switch kindOf(b) {
+	case boolKind:
+		v, items := make([]bool, n), boolsOf(b)
+		for i := range v {
+			v[i] = items[i%len(items)]
+		}
+		return newBools(shape, v), true
+	case intKind:
+		v, items := make([]int64, n), intsOf(b)
+		for i := range v {
+			v[i] = items[i%len(items)]
+		}
+		return newInts(shape, v), true
+	case floatKind:
+		v, items := make([]float64, n), floatsOf(b)
+		for i := range v {
+			v[i] = items[i%len(items)]
+		}
+		return newFloats(shape, v), true
+	}
+	return nil, false
+}
+
+// indexPacked returns the index in origin 'io' of the first occurrence of
+// each item of 'b' in the items of 'a', where 'a' and 'b' are packed arrays
+// or numbers of integers or booleans.
+// It returns false when there is no fast path.
+func indexPacked(a, b Value, io int) (Value, bool) {
+	ka, kb := kindOf(a), kindOf(b)
+	if (!isPacked(a) && !isPacked(b)) || ka == noKind || kb == noKind || ka == floatKind || kb == floatKind {
+		return nil, false
+	}
+	haystack, needles := intsOf(a), intsOf(b)
+	first := make(map[int64]int, len(haystack))
+	for j := len(haystack) - 1; j >= 0; j-- {
+		first[haystack[j]] = j
+	}
+	v := make([]int64, len(needles))
+	for i, needle := range needles {
+		j, ok := first[needle]
+		if !ok {
+			j = len(haystack)
+		}
+		v[i] = int64(j + io)
+	}
+	return newInts(shapeOf(b), v), true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+var (
+	// parallelThreshold is the number of items above which the work on an
+	// array is split into chunks run on several goroutines, it is also the
+	// size of the chunks. A threshold of 0 or 1 makes chunks of one item.
+	parallelThreshold = 1 << 16
+
+	// singleThread forces all the work to run on the calling goroutine.
+	singleThread = false
+)
+
+// chunks splits the range [0, n) in consecutive chunks of at most 'size'
+// items and calls fn on each of them with the index of the chunk and its
+// bounds [lo, hi).
+// The chunks run on up to GOMAXPROCS goroutines unless singleThread is set.
+// They only depend on 'n' and 'size' so the work done on each chunk is the
+// same however many goroutines run them.
+func chunks(n, size int, fn func(c, lo, hi int)) {
+	if size < 1 {
+		size = 1
+	}
+	count := (n + size - 1) / size
+	workers := runtime.GOMAXPROCS(0)
+	if count < workers {
+		workers = count
+	}
+	bounds := func(c int) (int, int) {
+		lo, hi := c*size, (c+1)*size
+		if hi > n {
+			hi = n
+		}
+		return lo, hi
+	}
+	if singleThread || workers <= 1 {
+		for c := 0; c < count; c++ {
+			lo, hi := bounds(c)
+			fn(c, lo, hi)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range next {
+				lo, hi := bounds(c)
+				fn(c, lo, hi)
+			}
+		}()
+	}
+	for c := 0; c < count; c++ {
+		next <- c
+	}
+	close(next)
+	wg.Wait()
+}
+
+// chunkCount returns the number of chunks of at most 'size' items needed to
+// cover 'n' items.
+func chunkCount(n, size int) int {
+	if size < 1 {
+		size = 1
+	}
+	return (n + size - 1) / size
+}
+
+// ranges calls fn on the chunks of at most 'size' items of [0, n) and
+// reports whether all the calls returned true.
+func ranges(n, size int, fn func(lo, hi int) bool) bool {
+	ok := make([]bool, chunkCount(n, size))
+	chunks(n, size, func(c, lo, hi int) {
+		ok[c] = fn(lo, hi)
+	})
+	for _, ok := range ok {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// forEach calls fn on each index of [0, n), split in chunks of
+// parallelThreshold items. It returns the error of the lowest index that
+// failed, if any.
+func forEach(n int, fn func(i int) error) error {
+	errs := make([]error, chunkCount(n, parallelThreshold))
+	chunks(n, parallelThreshold, func(c, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			if err := fn(i); err != nil {
+				errs[c] = err
+				return
+			}
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
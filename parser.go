@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
 	"io"
+	"strings"
 )
 
 var (
@@ -10,321 +10,599 @@ var (
 	stack map[string]Value
 )
 
+// originName is the name of the system variable holding the index origin,
+// the index of the first item of a vector, 0 or 1.
+const originName = "io"
+
 func init() {
 	stack = make(map[string]Value)
+	stack[originName] = Int(1)
+}
+
+// indexOrigin returns the current index origin.
+func indexOrigin() int {
+	if io, ok := stack[originName].(Int); ok {
+		return int(io)
+	}
+	return 1
 }
 
 // Parser represents a parser.
 type Parser struct {
-	s   *Scanner
-	buf struct {
-		t    []Token  // stack of last read tokens
-		lit  []string // stack of last read literals
-		n    int      // buffer size (max=1)
-		size int      // stack size for 't' and 'lit'
+	s     *Scanner
+	funcs map[string]bool // names assigned so far, true if they are functions
+	scope *scope          // variables the names that are not assigned refer to
+	names map[string]bool // names looked up in scope, true if they are functions
+	buf   struct {
+		t   []Token  // tokens read so far
+		lit []string // literals read so far
+		pos []Pos    // positions of the tokens read so far
+		i   int      // index of the next token to return
 	}
 }
 
 // NewParser returns a new instance of Parser.
 func NewParser(r io.Reader) *Parser {
-	p := Parser{s: NewScanner(r)}
-	p.buf.size = 10
-	return &p
+	return &Parser{s: NewScanner(r), funcs: make(map[string]bool)}
 }
 
-// scan returns the next token from the underlying scanner.
-// if a token has been unscanned then read that instead.
+// scan returns the next non-whitespace token from the underlying scanner.
+// if tokens have been unscanned then read those instead.
 func (p *Parser) scan() (t Token, lit string) {
-	if p.buf.n != 0 {
-		// todo(santiaago): refactor
-		t, p.buf.t = p.buf.t[len(p.buf.t)-1], p.buf.t[:len(p.buf.t)-1]
-		lit, p.buf.lit = p.buf.lit[len(p.buf.lit)-1], p.buf.lit[:len(p.buf.lit)-1]
-		p.buf.n--
+	if p.buf.i < len(p.buf.t) {
+		t, lit = p.buf.t[p.buf.i], p.buf.lit[p.buf.i]
+		p.buf.i++
 		return
 	}
 
-	t, lit = p.s.Scan()
-	if len(p.buf.t) < p.buf.size {
-		p.buf.t = append(p.buf.t, t)
-		p.buf.lit = append(p.buf.lit, lit)
-	} else {
-		// stack limit reached so shift values and insert new ones
-		// todo(santiaago): refactor
-		p.buf.t = p.buf.t[1:]
-		p.buf.t = append(p.buf.t, t)
-		p.buf.lit = p.buf.lit[1:]
-		p.buf.lit = append(p.buf.lit, lit)
+	t, lit, pos := p.s.Scan()
+	for t == Space {
+		t, lit, pos = p.s.Scan()
 	}
+	p.buf.t = append(p.buf.t, t)
+	p.buf.lit = append(p.buf.lit, lit)
+	p.buf.pos = append(p.buf.pos, pos)
+	p.buf.i++
 	return
 }
 
 // unscan pushes the previously read token back onto the buffer.
 func (p *Parser) unscan() {
-	if p.buf.n == p.buf.size {
-		fmt.Println("ERROR cannot unscan anymore, stack size limit reached.")
-		return
+	if p.buf.i > 0 {
+		p.buf.i--
 	}
-	p.buf.n++
 }
 
-// scanIgnoreWhitespace scans the next non-whitespace token.
-func (p *Parser) scanIgnoreWhitespace() (t Token, lit string) {
-	t, lit = p.scan()
-	if t == Space {
-		t, lit = p.scan()
+// peek returns the next non-whitespace token without consuming it.
+func (p *Parser) peek() Token {
+	t, _ := p.scan()
+	p.unscan()
+	return t
+}
+
+// pos returns the position of the last scanned token.
+func (p *Parser) pos() Pos {
+	if p.buf.i == 0 {
+		return NoPos
 	}
-	return
+	return p.buf.pos[p.buf.i-1]
 }
 
-// numberOrVector returns a number or a vector.
-func (p *Parser) numberOrVector() Value {
-	tok, lit := p.scanIgnoreWhitespace()
-	var vector Vector
-	if tok == Number {
-		vector = append(vector, ValueParse(lit))
-	} else if tok == Operator && lit == "-" {
-		// todo(santiaago): handle this as a unary operator.
-		// we use scan here because the '-' sign number must be
-		// right next to number, no space in between
-		tok, lit = p.scan()
-		if tok == Number {
-			vector = append(vector, ValueParse("-"+lit))
-		} else {
-			return nil
+// text returns the source of the tokens read from 'from' to 'to', spaced
+// as they are in the input.
+func (p *Parser) text(from, to int) string {
+	src := ""
+	for i := from; i < to; i++ {
+		if i > from {
+			end := p.buf.pos[i-1].Offset + len(p.buf.lit[i-1])
+			src += strings.Repeat(" ", p.buf.pos[i].Offset-end)
 		}
-	} else {
-		return nil
+		src += p.buf.lit[i]
 	}
+	return src
+}
 
-	for {
-		// Read a field.
-		tok, lit := p.scanIgnoreWhitespace()
-		if tok == Operator && lit == "-" {
-			// we use scan here because the '-' sign number must be
-			// right next to number, no space in between
-			tok, lit = p.scan()
-			if tok == Number {
-				lit = "-" + lit
-			} else {
-				// unscan twice to roll back both scan
-				p.unscan()
-				p.unscan()
-				break
+// errorf returns a syntax error at the position of the last scanned token.
+func (p *Parser) errorf(format string, a ...interface{}) error {
+	return atPos(newError(SyntaxError, "", format, a...), p.pos())
+}
+
+// Parse parses a statement, that is an expression where assignments
+// 'a = b' can show up anywhere a dyadic operator can.
+func (p *Parser) Parse() (*Expression, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scan(); tok != EOF {
+		return nil, p.errorf("found %q, expected operator or end of line", lit)
+	}
+	return &expr, nil
+}
+
+// parseAssign parses the right hand side of an assignment to 'target', a
+// variable or an indexed variable.
+// The '=' has already been read.
+// example a = b = 0
+// 0
+func (p *Parser) parseAssign(target Expression) (Expression, error) {
+	pos := p.pos()
+	switch t := target.(type) {
+	case Variable:
+		val, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.funcs[t.name] = p.isValueFunction(val)
+		return Assignment{name: t.name, Val: val, pos: pos}, nil
+	case Index:
+		if _, ok := t.Val.(Variable); ok {
+			val, err := p.parseExpr()
+			if err != nil {
+				return nil, err
 			}
-		} else if tok != Number {
-			p.unscan()
-			break
+			return IndexAssign{Index: t, Val: val, pos: pos}, nil
 		}
-		v := ValueParse(lit)
-		vector = append(vector, v)
 	}
+	return nil, p.errorf("only a variable can be assigned")
+}
 
-	// todo(santiaago) do we need this?
-	if len(vector) == 1 {
-		return vector[0]
+// isValueFunction determines if the expression passed as param is a
+// user-defined function.
+func (p *Parser) isValueFunction(expr Expression) bool {
+	switch x := expr.(type) {
+	case Dfn:
+		return true
+	case Variable:
+		return p.isFunction(x.name)
+	case Assignment:
+		return p.funcs[x.name]
 	}
-	return vector
+	return false
 }
 
-// Parse parse a assign statement a = b
-func (p *Parser) Parse() (*Expression, error) {
+// parseExpr parses an expression.
+// There is no precedence between operators, APL expressions are evaluated
+// from right to left so the right argument of an operator is the whole
+// expression to its right. This is also true for assignments.
+// example 2 * 3 + 4
+// 14
+// example 1 + a = 5
+// 6
+func (p *Parser) parseExpr() (Expression, error) {
+	fn, pos, err := p.parseFunction()
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		return p.parseMonadic(fn, pos)
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, _ := p.scan()
+	if tok == Assign {
+		return p.parseAssign(left)
+	}
+	if tok == Jot {
+		return p.parseOuter(left)
+	}
+	p.unscan()
+	if fn, pos, err = p.parseFunction(); err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return left, nil
+	}
+	return p.parseDyadic(left, fn, pos)
+}
+
+// parseFunction parses a function if there is one next, that is a built-in
+// function, a variable holding a user-defined function or a user-defined
+// function in braces.
+// It returns a nil function otherwise, with the position of the function.
+func (p *Parser) parseFunction() (Expression, Pos, error) {
+	tok, lit := p.scan()
+	pos := p.pos()
+	if tok == Operator {
+		return Primitive(lit), pos, nil
+	}
+	if tok == Identifier && p.isFunction(lit) && p.peek() != Assign {
+		return Variable{name: lit, pos: pos}, pos, nil
+	}
+	if tok == LeftBrace {
+		fn, err := p.parseDfn()
+		return fn, pos, err
+	}
+	p.unscan()
+	return nil, pos, nil
+}
+
+// isFunction determines if the identifier passed as param names a
+// user-defined function, either assigned one in what has been parsed so far
+// or holding one.
+// A variable assigned the result of a call is only known to hold a function
+// in the lines that follow.
+// The names looked up in the variables are recorded so that a user-defined
+// function is parsed again when one of them changes.
+func (p *Parser) isFunction(name string) bool {
+	if name == selfName {
+		return true
+	}
+	if ok, found := p.funcs[name]; found {
+		return ok
+	}
+	v, _ := p.scope.lookup(name)
+	_, ok := v.(Dfn)
+	if p.names != nil {
+		p.names[name] = ok
+	}
+	return ok
+}
 
-	// First token can be an identifier or number(a number can start with a '-' sign)
-	// todo(santiaago): refactor first token.
-	var left Value
-	var right, operator string
-	tok, lit := p.scanIgnoreWhitespace()
-	lastTok := tok
-	if tok == Identifier {
-		left = Variable{name: lit}
-	} else if tok == Number {
+// parseMonadic parses the application of the function 'fn' found at 'pos'
+// to the expression on its right, or of the function derived from it by an
+// operator.
+// A user-defined function with nothing on its right is a value.
+// example dim 1 2 3
+// example avg 1 2 3
+func (p *Parser) parseMonadic(fn Expression, pos Pos) (Expression, error) {
+	if t, op := p.scan(); t == Operator && (op == "/" || op == "\\") {
+		return p.parseReduce(fn, op == "\\")
+	} else if t == Diaeresis {
 		p.unscan()
-		left = p.numberOrVector()
-	} else if tok == Operator {
-		if lit == "-" {
-			p.unscan()
-			left = p.numberOrVector()
-			if left != nil {
-				lastTok = Number
-			}
-		} else if isUnary(lit) {
-			// remember operator
-			p.unscan()
-			operator = lit
+		return p.parseEach(nil, fn, pos)
+	}
+	p.unscan()
+	if f, ok := fn.(Primitive); ok {
+		if !isUnary(string(f)) {
+			return nil, atPos(newError(SyntaxError, "", "found %q, expected number or identifier", f), pos)
 		}
-		// todo(santiaago): need to handle negative identifiers and vectors.
-	} else {
-		return nil, fmt.Errorf("ERROR found %q, expected left", lit)
-	}
-
-	// Next it could be EOF, an operator or an assignment (for now)
-	// todo(santiaago): refactor EOF case.
-	tok, lit = p.scanIgnoreWhitespace()
-	if tok == EOF {
-		if lastTok == Number {
-			expr := Expression(left)
-			return &expr, nil
-		} else if lastTok == Identifier {
-			// todo(santiaago): do we need this error check?
-			if left.Evaluate() == nil {
-				return nil, fmt.Errorf("ERROR")
-			}
-			expr := Expression(left)
-			return &expr, nil
-		} else {
-			return nil, fmt.Errorf("ERROR not a number or identifier")
+		right, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
+		return Unary{Val: right, Operator: string(f), pos: pos}, nil
 	}
-
-	isOperator := tok == Operator
-	isAssign := tok == Assign
-	isNumber := tok == Number
-	if !isAssign && !isOperator && !isNumber {
-		return nil, fmt.Errorf("ERROR found %q, expected assignment, operator or number. Got token %v", lit, tok)
+	switch p.peek() {
+	case EOF, RightParen, RightBrace, RightBracket, Diamond, Colon, Semicolon:
+		return fn, nil
+	}
+	right, err := p.parseExpr()
+	if err != nil {
+		return nil, err
 	}
+	return Call{Fn: fn, Right: right, pos: pos}, nil
+}
 
-	// if the literal scanned was a number we unscan it to scan it completly.
-	// This is to scan all numbers in a vector and don't skip the first one.
-	if isNumber {
-		p.unscan()
+// parseDyadic parses the application of the function 'fn' found at 'pos' to
+// the operand 'left' and the expression on its right, or of the function
+// derived from it by an operator.
+// example 1 2 + 3
+// example 1 {⍺ + ⍵} 2
+func (p *Parser) parseDyadic(left, fn Expression, pos Pos) (Expression, error) {
+	f, ok := fn.(Primitive)
+	if ok && !isBinary(string(f)) {
+		return nil, atPos(newError(SyntaxError, "", "found %q, expected a dyadic operator", f), pos)
 	}
+	if p.peek() == Dot {
+		return p.parseInner(left, fn, pos)
+	}
+	if p.peek() == Diaeresis {
+		return p.parseEach(left, fn, pos)
+	}
+	right, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return Binary{Left: left, Right: right, Operator: string(f), pos: pos}, nil
+	}
+	return Call{Fn: fn, Left: left, Right: right, pos: pos}, nil
+}
 
-	// if last token read is an operator, remember it.
-	if isOperator {
-		operator = lit
+// parseDyadicFunction parses the dyadic function operand of an operator.
+func (p *Parser) parseDyadicFunction() (Expression, error) {
+	fn, pos, err := p.parseFunction()
+	if err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		_, lit := p.scan()
+		return nil, p.errorf("found %q, expected a dyadic function", lit)
 	}
+	if f, ok := fn.(Primitive); ok && !isBinary(string(f)) {
+		return nil, atPos(newError(SyntaxError, "", "found %q, expected a dyadic function", f), pos)
+	}
+	return fn, nil
+}
 
-	// Next: Take care of assign case.
-	// todo(santiaago): refactor assign case.
-	if isAssign {
-		tok, lit = p.scanIgnoreWhitespace()
-		if tok == Number {
-			// todo(santiaago):
-			// we should print an error here if left is a number and
-			// not a variable as the asignment 1 = 2 doesn't make sense.
-			var expr Expression
-			if v, ok := left.(Variable); ok {
-				stack[v.name] = ValueParse(lit)
-				expr = Expression(v)
-			} else {
-				return nil, fmt.Errorf("ERROR left hand side should be a variable")
-			}
-			return &expr, nil
-		} else if lastTok == Number {
-			return nil, fmt.Errorf("ERROR left hand side should be a variable")
-		} else if tok == Identifier {
-			right = lit
-			var expr Expression
-			var r Value
-			if val, ok := stack[right]; ok {
-				r = val
-			} else {
-				return nil, fmt.Errorf("ERROR variable undefined")
-			}
-			if v, ok := left.(Variable); ok {
-				stack[v.name] = r
-				expr = Expression(v)
-			}
-			return &expr, nil
+// parseReduce parses the application of the function derived from the
+// dyadic function 'fn' by the reduce or the scan operator, with an optional
+// axis in brackets.
+// The operator has already been read.
+// example +/ 1 2 3
+// example max\[1] m
+func (p *Parser) parseReduce(fn Expression, scan bool) (Expression, error) {
+	if f, ok := fn.(Primitive); ok && !isBinary(string(f)) {
+		p.unscan()
+		return nil, p.errorf("found %q, expected a dyadic function", f)
+	}
+	r := Reduce{Func: fn, Scan: scan, pos: p.pos()}
+	if p.peek() == LeftBracket {
+		p.scan()
+		axis, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("ERROR right hand side has unexpected token")
+		if tok, lit := p.scan(); tok != RightBracket {
+			return nil, p.errorf("found %q, expected ']'", lit)
+		}
+		r.Axis = axis
+	}
+	val, err := p.parseExpr()
+	if err != nil {
+		return nil, err
 	}
+	r.Val = val
+	return r, nil
+}
+
+// parseOuter parses the outer product by a dyadic function of the operand
+// 'left' and the expression on the right.
+// The jot has already been read.
+// example (iota 3) ∘.* iota 3
+func (p *Parser) parseOuter(left Expression) (Expression, error) {
+	pos := p.pos()
+	if tok, lit := p.scan(); tok != Dot {
+		return nil, p.errorf("found %q, expected '.'", lit)
+	}
+	fn, err := p.parseDyadicFunction()
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return Outer{Left: left, Right: right, Func: fn, pos: pos}, nil
+}
 
-	// Next: Take care of the operator case.
-	// todo(santiaago): refactor this.
-	// We should loop over all our operators.
-	var terms []Value
-	var operators []string
+// parseInner parses the inner product by the dyadic function 'f' found at
+// 'pos' and the one following the dot of the operand 'left' and the
+// expression on the right.
+// The function 'f' has already been read.
+// example (2 2 shape iota 4) +.* 1 2
+func (p *Parser) parseInner(left, f Expression, pos Pos) (Expression, error) {
+	p.scan()
+	g, err := p.parseDyadicFunction()
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return Inner{Left: left, Right: right, F: f, G: g, pos: pos}, nil
+}
 
-	// Initialize arrays with first term and first operator.
-	if left != nil {
-		terms = append(terms, left)
+// parseEach parses the application of the function derived from the
+// function 'fn' found at 'pos' by the each operator to the expression on the
+// right, and to the operand 'left' if 'fn' is used dyadically.
+// The function has already been read, the operator is next.
+// example dim¨ (1 2) (3 4 5)
+// example 1 2 shape¨ 3 4
+func (p *Parser) parseEach(left, fn Expression, pos Pos) (Expression, error) {
+	if f, ok := fn.(Primitive); ok && left == nil && !isUnary(string(f)) {
+		return nil, atPos(newError(SyntaxError, "", "found %q, expected a monadic function", f), pos)
+	}
+	p.scan()
+	right, err := p.parseExpr()
+	if err != nil {
+		return nil, err
 	}
-	operators = append(operators, operator)
+	return Each{Func: fn, Left: left, Right: right, pos: pos}, nil
+}
 
+// parseDfn parses a user-defined function, statements separated by '⋄'.
+// A statement is an expression or a guard 'condition: expression'.
+// The opening '{' has already been read.
+// example {⍵ <= 1: 1 ⋄ ⍵ * ∇ ⍵ - 1}
+func (p *Parser) parseDfn() (Expression, error) {
+	d, start := Dfn{names: make(map[string]bool)}, p.buf.i-1
+	outer := p.names
+	p.names = d.names
+	defer func() {
+		// the names of a nested function are also those of the outer one.
+		for name, ok := range d.names {
+			if outer != nil {
+				outer[name] = ok
+			}
+		}
+		p.names = outer
+	}()
 	for {
-		// Read a field.
-		tok, lit = p.scanIgnoreWhitespace()
-		if tok != Identifier && tok != Number && tok != Operator {
-			return nil, fmt.Errorf("ERROR found %q, expected number or identifier or sign", lit)
+		stmt, err := p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
-		// todo(santiaago): should check here cases (number, identifier, sign)
-		if tok == Number || tok == Operator {
-			p.unscan()
-			term := p.numberOrVector()
-
-			terms = append(terms, term)
-		} else if tok == Identifier {
-			if _, ok := stack[lit]; ok {
-				terms = append(terms, stack[lit])
-			} else {
-				return nil, fmt.Errorf("ERROR variable %v not found", lit)
+		if p.peek() == Colon {
+			p.scan()
+			pos := p.pos()
+			val, err := p.parseExpr()
+			if err != nil {
+				return nil, err
 			}
+			stmt = Guard{Cond: stmt, Val: val, pos: pos}
+		}
+		d.Body = append(d.Body, stmt)
+		tok, lit := p.scan()
+		if tok == RightBrace {
+			d.src = p.text(start, p.buf.i)
+			return d, nil
+		}
+		if tok != Diamond {
+			return nil, p.errorf("found %q, expected '⋄' or '}'", lit)
 		}
-		// Read operator
-		tok, lit = p.scanIgnoreWhitespace()
-		// If the next token is not an operator then break the loop
-		if tok != Operator {
+	}
+}
+
+// parseBody parses the body of the user-defined function 'd' again, where
+// the names that are not assigned in it refer to the variables of the scope
+// 's'.
+func parseBody(d Dfn, s *scope) ([]Expression, error) {
+	p := NewParser(strings.NewReader(d.src))
+	p.scope = s
+	if tok, lit := p.scan(); tok != LeftBrace {
+		return nil, p.errorf("found %q, expected '{'", lit)
+	}
+	fn, err := p.parseDfn()
+	if err != nil {
+		return nil, err
+	}
+	return fn.(Dfn).Body, nil
+}
 
+// parseOperand parses an operand which is a variable, a number, a string,
+// a parenthesized expression or a strand of them.
+// Adjacent items form a vector, an item that is itself a vector makes a
+// nested vector.
+// example 1 2 a
+// example 1 (2 3) 4
+func (p *Parser) parseOperand() (Expression, error) {
+	var items []Expression
+	numbers := true
+	for {
+		tok, lit := p.scan()
+		if tok == Number {
+			v, err := ValueParse(lit)
+			if err != nil {
+				return nil, atPos(err, p.pos())
+			}
+			items = append(items, v)
+		} else if tok == String {
+			expr, err := p.parseIndex(stringValue(lit))
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := expr.(Char); !ok {
+				numbers = false
+			}
+			items = append(items, expr)
+		} else if tok == Identifier && (!p.isFunction(lit) || p.peek() == Assign) {
+			expr, err := p.parseIndex(Variable{name: lit, pos: p.pos()})
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, expr)
+			numbers = false
+		} else if tok == LeftParen {
+			expr, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			if expr, err = p.parseIndex(expr); err != nil {
+				return nil, err
+			}
+			items = append(items, expr)
+			numbers = false
+		} else {
 			p.unscan()
 			break
 		}
-		operators = append(operators, lit)
 	}
 
-	// At this point we have terms and, operators.
-	// We now need to process all of this.
-	return buildOperatorExpression(terms, operators)
+	if len(items) == 0 {
+		_, lit := p.scan()
+		return nil, p.errorf("found %q, expected number or identifier", lit)
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	if !numbers {
+		return Strand(items), nil
+	}
+	var vector Vector
+	for _, item := range items {
+		vector = append(vector, item.(Value))
+	}
+	return vector, nil
+}
+
+// parseGroup parses a parenthesized expression.
+// The opening '(' has already been read.
+func (p *Parser) parseGroup() (Expression, error) {
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scan(); tok != RightParen {
+		return nil, p.errorf("found %q, expected ')'", lit)
+	}
+	return expr, nil
 }
 
-// At this point we have the following
-// left, operator, terms, operators
-// we need now to process all of this.
-func buildOperatorExpression(terms []Value, operators []string) (*Expression, error) {
-
-	var cumulExpr Expression
-	first := terms[0]
-	// todo(santiaago):
-	// you should be able to do:
-	//     a = 1
-	// 1
-	//     1 2 a
-	// 1 2 1
-	// This means that a vector can also contain identifiers.
-	// we will ignore this case for now, we will only work with vector of numbers.
-	// if _, ok := stack[first]; ok {
-	// 	cumulExpr = Expression(Variable{name: first})
-	// } else {
-	cumulExpr = first
-	//}
-
-	for i := 0; i < len(operators); i++ {
-		op := operators[i]
-		// unary case
-		// todo(santiaago): how to handle +/ 1 2 3 + +/ 1 2 3 ?
-		if isUnary(op) {
-			u := Unary{Val: cumulExpr.Evaluate(), Operator: op}
-			cumulExpr = Expression(u)
-			continue
+// parseIndex parses the subscripts following 'expr' if any and returns the
+// indexed expression.
+// Subscripts are separated by ';', one for each axis.
+// example m[1;2]
+// example y[-2:]
+func (p *Parser) parseIndex(expr Expression) (Expression, error) {
+	for {
+		if tok, _ := p.scan(); tok != LeftBracket {
+			p.unscan()
+			return expr, nil
 		}
-		// todo(santiaago): need to clean this.
-		if len(terms)-1 != len(operators) {
-			return nil, fmt.Errorf("ERROR terms and operators size mismatch")
+		pos := p.pos()
+		var subs []Subscript
+		for {
+			sub, err := p.parseSubscript()
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+			tok, lit := p.scan()
+			if tok == RightBracket {
+				break
+			}
+			if tok != Semicolon {
+				return nil, p.errorf("found %q, expected ';' or ']'", lit)
+			}
 		}
-		right := terms[i+1]
-
-		var r Value
-		// if val, ok := stack[right]; ok {
-		// 	r = val
-		// } else {
-		r = right
-		//}
-		if cumulExpr != nil {
-			b := Binary{Left: cumulExpr.Evaluate(), Right: r, Operator: op}
-			cumulExpr = Expression(b)
-		} else {
-			return nil, fmt.Errorf("ERROR nil expression")
+		expr = Index{Val: expr, Subs: subs, pos: pos}
+	}
+}
+
+// parseSubscript parses the subscript of one axis, that is an expression,
+// a slice 'from:to' with optional bounds or nothing to select the whole axis.
+func (p *Parser) parseSubscript() (Subscript, error) {
+	var sub Subscript
+	if p.peek() == Semicolon || p.peek() == RightBracket {
+		sub.Slice = true
+		return sub, nil
+	}
+	if p.peek() != Colon {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return sub, err
 		}
+		sub.Expr = expr
+	}
+	if tok, _ := p.scan(); tok != Colon {
+		p.unscan()
+		return sub, nil
+	}
+	sub.Slice, sub.From, sub.Expr = true, sub.Expr, nil
+	if p.peek() == Semicolon || p.peek() == RightBracket {
+		return sub, nil
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return sub, err
 	}
-	return &cumulExpr, nil
+	sub.To = expr
+	return sub, nil
 }
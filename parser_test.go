@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
@@ -15,13 +16,14 @@ func TestParser_Scan(t *testing.T) {
 		{s: `a = 1`, expr: Variable{name: "a"}},
 		{s: `1 + 2`, expr: Binary{Left: Int(1), Right: Int(2), Operator: "+"}},
 		{s: `1 / 2`, expr: Binary{Left: Int(1), Right: Int(2), Operator: "/"}},
+		{s: `1.5 + 2`, expr: Binary{Left: Float(1.5), Right: Int(2), Operator: "+"}},
 		{s: `1 - 2`, expr: Binary{Left: Int(1), Right: Int(2), Operator: "-"}},
 		{s: `1* 2`, expr: Binary{Left: Int(1), Right: Int(2), Operator: "*"}},
 		{s: `2 ** 2`, expr: Binary{Left: Int(2), Right: Int(2), Operator: "**"}},
 		{s: `a + 2`, expr: Binary{Left: Int(1), Right: Int(2), Operator: "+"}},
 		{s: `2 + a`, expr: Binary{Left: Int(2), Right: Int(1), Operator: "+"}},
 		{s: `a + a`, expr: Binary{Left: Int(1), Right: Int(1), Operator: "+"}},
-		{s: `a + a - a + a`, expr: Int(2)},
+		{s: `a + a - a + a`, expr: Int(0)},
 		{s: `a + a + a + a`, expr: Int(4)},
 		{s: `b = 42`, expr: Variable{name: "b"}},
 		{s: `a = b`, expr: Variable{name: "a"}},
@@ -51,12 +53,12 @@ func TestParser_Scan(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" &&
-			!reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" &&
+			!reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v", i, tt.s, exp, got)
 		}
 	}
 }
@@ -72,11 +74,11 @@ func TestParser_NumberValues(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -101,11 +103,11 @@ func TestParser_Errors(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -123,11 +125,11 @@ func TestParser_VariableValues(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -142,8 +144,13 @@ func TestParser_NumberArithmeticValues(t *testing.T) {
 		{s: `1 - 2`, expr: Int(-1)},
 		{s: `-1 + 2`, expr: Int(1)},
 		{s: `-1 + -2`, expr: Int(-3)},
-		{s: `1 / 2`, expr: Int(0)},
-		{s: `-1 - -2 + -10`, expr: Int(-9)},
+		{s: `1 / 2`, expr: Rational{big.NewRat(1, 2)}},
+		{s: `6 / 3`, expr: Int(2)},
+		{s: `-1 - -2 + -10`, expr: Int(11)},
+		{s: `2 * 3 + 4`, expr: Int(14)},
+		{s: `2 + 3 * 4`, expr: Int(14)},
+		{s: `10 - 4 - 3`, expr: Int(9)},
+		{s: `2 ** 3 ** 2`, expr: Int(512)},
 		{s: `1* 2`, expr: Int(2)},
 		{s: `2 ** 2`, expr: Int(4)},
 		{s: `2 max 1`, expr: Int(2)},
@@ -151,11 +158,11 @@ func TestParser_NumberArithmeticValues(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -169,19 +176,23 @@ func TestParser_VariablerArithmeticValues(t *testing.T) {
 		{s: `a = 1`, expr: Int(1)},
 		{s: `2 + a`, expr: Int(3)},
 		{s: `a + a`, expr: Int(2)},
-		{s: `a + a - a + a`, expr: Int(2)},
+		{s: `a + a - a + a`, expr: Int(0)},
 		{s: `a + a + a + a`, expr: Int(4)},
 		{s: `b = 42`, expr: Int(42)},
 		{s: `a = b`, expr: Int(42)},
 		{s: `a + b`, expr: Int(84)},
+		{s: `a-1`, expr: Int(41)},
+		{s: `a -1`, expr: Int(41)},
+		{s: `a - 1`, expr: Int(41)},
+		{s: `a ¯1`, expr: Vector([]Value{Int(42), Int(-1)})},
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -195,14 +206,16 @@ func TestParser_VectorValues(t *testing.T) {
 		{s: `1 2 3 4`, expr: Vector([]Value{Int(1), Int(2), Int(3), Int(4)})},
 		{s: `-1 -2 -3 -4`, expr: Vector([]Value{Int(-1), Int(-2), Int(-3), Int(-4)})},
 		{s: `-1 -2 3 4`, expr: Vector([]Value{Int(-1), Int(-2), Int(3), Int(4)})},
+		{s: `¯1 ¯2 3 4`, expr: Vector([]Value{Int(-1), Int(-2), Int(3), Int(4)})},
+		{s: `2-3`, expr: Int(-1)},
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -241,11 +254,41 @@ func TestParser_VectorArithmeticValues(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
+		}
+	}
+}
+
+func TestParser_ScalarExtensionValues(t *testing.T) {
+	var tests = []struct {
+		s    string
+		expr Expression
+		err  string
+	}{
+		{s: `1 2 3 + 1`, expr: Vector([]Value{Int(2), Int(3), Int(4)})},
+		{s: `1 + 1 2 3`, expr: Vector([]Value{Int(2), Int(3), Int(4)})},
+		{s: `10 - 1 2 3`, expr: Vector([]Value{Int(9), Int(8), Int(7)})},
+		{s: `1 2 3 - 10`, expr: Vector([]Value{Int(-9), Int(-8), Int(-7)})},
+		{s: `2 * 1 2 3`, expr: Vector([]Value{Int(2), Int(4), Int(6)})},
+		{s: `1 2 3 ** 2`, expr: Vector([]Value{Int(1), Int(4), Int(9)})},
+		{s: `2 ** 1 2 3`, expr: Vector([]Value{Int(2), Int(4), Int(8)})},
+		{s: `1 2 3 max 2`, expr: Vector([]Value{Int(2), Int(2), Int(3)})},
+		{s: `2 min 1 2 3`, expr: Vector([]Value{Int(1), Int(2), Int(2)})},
+		{s: `1 2 3 / 1.`, expr: Vector([]Value{Float(1), Float(2), Float(3)})},
+		{s: `1 2 3 + +/ 1 2 3`, expr: Vector([]Value{Int(7), Int(8), Int(9)})},
+		{s: `+/ 1 2 3 * 2`, expr: Int(12)},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
 		}
 	}
 }
@@ -270,18 +313,1144 @@ func TestParser_ScanOperationsValues(t *testing.T) {
 			expr: Vector([]Value{Int(1), Int(2), Int(6), Int(24)}),
 		},
 		{s: `*/ 1 2 3 4`, expr: Int(24)},
+		{s: `+/ 1 2 3 + 1 1 1`, expr: Int(9)},
+		{s: `+/ +\ 1 2 3`, expr: Int(10)},
+		{s: `2 * +/ 1 2 3`, expr: Int(12)},
+		{s: `1 2 3 * +\ 1 1 1`, expr: Vector([]Value{Int(1), Int(4), Int(9)})},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
+		}
+	}
+}
+
+func TestParser_FloatValues(t *testing.T) {
+	var tests = []struct {
+		s    string
+		expr Expression
+		err  string
+	}{
+		{s: `1.5`, expr: Float(1.5)},
+		{s: `.5`, expr: Float(0.5)},
+		{s: `-.5`, expr: Float(-0.5)},
+		{s: `-1.5`, expr: Float(-1.5)},
+		{s: `1e-3`, expr: Float(0.001)},
+		{s: `1E6`, expr: Float(1e6)},
+		{s: `2.5e+2`, expr: Float(250)},
+		{s: `1.5 2 .25`, expr: Vector([]Value{Float(1.5), Int(2), Float(0.25)})},
+		{s: `1.5 + 1`, expr: Float(2.5)},
+		{s: `1 + 1.5`, expr: Float(2.5)},
+		{s: `1.5 - 2`, expr: Float(-0.5)},
+		{s: `1.5 * 2`, expr: Float(3)},
+		{s: `3 / 1.5`, expr: Float(2)},
+		{s: `2 ** -1`, expr: Rational{big.NewRat(1, 2)}},
+		{s: `2 ** -1.`, expr: Float(0.5)},
+		{s: `4 ** .5`, expr: Float(2)},
+		{s: `2 max 2.5`, expr: Float(2.5)},
+		{s: `2 min 2.5`, expr: Float(2)},
+		{s: `1 2 3 / 2. 2. 2.`, expr: Vector([]Value{Float(0.5), Float(1), Float(1.5)})},
+		{s: `+/ .5 .25 .25`, expr: Float(1)},
+		{s: `*\ 2 .5 3`, expr: Vector([]Value{Int(2), Float(1), Float(3)})},
+		{s: `1e-400`, expr: Float(0)},
+		{s: `1e400`, err: `LIMIT ERROR: 1e400 is too large`},
+		{s: `1 -1e400`, err: `LIMIT ERROR: -1e400 is too large`},
+		{s: `1e400j1`, err: `LIMIT ERROR: 1e400j1 is too large`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
+		}
+	}
+}
+
+func TestParser_ExactValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+	}{
+		{s: `9223372036854775807 + 1`, val: `9223372036854775808`},
+		{s: `-9223372036854775807 - 2`, val: `-9223372036854775809`},
+		{s: `4294967296 * 4294967296`, val: `18446744073709551616`},
+		{s: `9223372036854775808 - 1`, val: `9223372036854775807`},
+		{s: `99999999999999999999 + 1`, val: `100000000000000000000`},
+		{s: `*/ 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25`, val: `15511210043330985984000000`},
+		{s: `2 ** 100`, val: `1267650600228229401496703205376`},
+		{s: `1 / 3`, val: `1/3`},
+		{s: `6 / 3`, val: `2`},
+		{s: `-2 / 6`, val: `-1/3`},
+		{s: `(1 / 3) + (2 / 3)`, val: `1`},
+		{s: `(1 / 3) * 3`, val: `1`},
+		{s: `(1 / 3) - (1 / 2)`, val: `-1/6`},
+		{s: `(2 / 3) ** 2`, val: `4/9`},
+		{s: `(2 / 3) ** -2`, val: `9/4`},
+		{s: `(1 / 3) max (1 / 2)`, val: `1/2`},
+		{s: `(1 / 3) min 1`, val: `1/3`},
+		{s: `(1 / 2) + .25`, val: `0.75`},
+		{s: `4 ** (1 / 2)`, val: `2`},
+		{s: `18446744073709551616 / 4294967296`, val: `4294967296`},
+		{s: `1 / 18446744073709551616`, val: `1/18446744073709551616`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if err != nil {
+			t.Errorf("%d. %q: unexpected error: %v", i, tt.s, err)
+		} else if got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch: exp=%s got=%s", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_ComplexValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+	}{
+		{s: `3j4`, val: `3j4`},
+		{s: `3J-4`, val: `3j-4`},
+		{s: `-1.5j.5`, val: `-1.5j0.5`},
+		{s: `3j0`, val: `3`},
+		{s: `1j1 2j2`, val: `1j1 2j2`},
+		{s: `1j2 + 3j4`, val: `4j6`},
+		{s: `1j2 - 1`, val: `0j2`},
+		{s: `1 - 1j2`, val: `0j-2`},
+		{s: `1j2 * 3j4`, val: `-5j10`},
+		{s: `1j1 * 1j-1`, val: `2`},
+		{s: `-5j10 / 3j4`, val: `1j2`},
+		{s: `(1 / 2) + 0j1`, val: `0.5j1`},
+		{s: `0j1 ** 2`, val: `-1`},
+		{s: `-4 ** .5`, val: `1.224646799e-16j2`},
+		{s: `real 3j4`, val: `3`},
+		{s: `imag 3j4`, val: `4`},
+		{s: `mag 3j4`, val: `5`},
+		{s: `mag -3`, val: `3`},
+		{s: `mag -1 / 3`, val: `1/3`},
+		{s: `phase 0j1`, val: `1.570796327`},
+		{s: `phase -1`, val: `3.141592654`},
+		{s: `conj 3j4`, val: `3j-4`},
+		{s: `conj 3`, val: `3`},
+		{s: `real 1j2 3j4 5`, val: `1 3 5`},
+		{s: `+/ 1j1 2j2 3j3`, val: `6j6`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if err != nil {
+			t.Errorf("%d. %q: unexpected error: %v", i, tt.s, err)
+		} else if got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch: exp=%s got=%s", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_ArrayValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `3 shape 1`, val: "1 1 1"},
+		{s: `5 shape 1 2`, val: "1 2 1 2 1"},
+		{s: `2 2 shape 1`, val: "1 1\n1 1"},
+		{s: `2 3 shape 1 2 3 4 5 6`, val: "1 2 3\n4 5 6"},
+		{s: `2 2 shape 1 10 100 2`, val: "  1 10\n100  2"},
+		{s: `2 2 2 shape 1 2 3 4 5 6 7 8`, val: "1 2\n3 4\n\n5 6\n7 8"},
+		{s: `2 2 shape -1 10`, val: "-1 10\n-1 10"},
+		{s: `(2 2 shape 1) + 2 2 shape 1`, val: "2 2\n2 2"},
+		{s: `(2 3 shape 1 2 3) * 2 3 shape 4 5 6`, val: "4 10 18\n4 10 18"},
+		{s: `(2 2 shape 1 2 3 4) - 1`, val: "0 1\n2 3"},
+		{s: `10 * 2 2 shape 1 2 3 4`, val: "10 20\n30 40"},
+		{s: `(2 2 2 shape 1) + 2 2 2 shape 1 2`, val: "2 3\n2 3\n\n2 3\n2 3"},
+		{s: `mag 2 2 shape -1 2`, val: "1 2\n1 2"},
+		{s: `dim 2 3 shape 1`, val: "2 3"},
+		{s: `dim 2 3 4 shape 1`, val: "2 3 4"},
+		{s: `dim 1 2 3`, val: "3"},
+		{s: `dim 5`, val: ""},
+		{s: `dim dim 2 3 shape 1`, val: "2"},
+		{s: `(2 2 shape 1) + 2 3 shape 1`, err: `LENGTH ERROR: +: arrays of shape [2 2] and [2 3]`},
+		{s: `(2 2 shape 1) + 1 2`, err: `RANK ERROR: +`},
+		{s: `-1 shape 1`, err: `DOMAIN ERROR: shape`},
+		{s: `1.5 shape 1`, err: `DOMAIN ERROR: shape`},
+		{s: `(2 2 shape 2) shape 1`, err: `RANK ERROR: shape`},
+		{s: `100000 100000 shape 1`, err: `LIMIT ERROR: shape`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_IotaValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `iota 5`, val: "1 2 3 4 5"},
+		{s: `iota 1`, val: "1"},
+		{s: `iota 0`, val: ""},
+		{s: `2 * iota 5`, val: "2 4 6 8 10"},
+		{s: `+/ iota 100`, val: "5050"},
+		{s: `2 3 shape iota 6`, val: "1 2 3\n4 5 6"},
+		{s: `iota dim 1 2 3`, val: "1 2 3"},
+		{s: `10 20 30 iota 30`, val: "3"},
+		{s: `10 20 30 iota 30 10 5`, val: "3 1 4"},
+		{s: `10 20 30 iota 2 2 shape 10 20 30 40`, val: "1 2\n3 4"},
+		{s: `1 2 3 iota 2.`, val: "2"},
+		{s: `(1 / 2) 3 iota .5`, val: "1"},
+		{s: `io`, val: "1"},
+		{s: `io = 0`, val: "0"},
+		{s: `iota 5`, val: "0 1 2 3 4"},
+		{s: `10 20 30 iota 30 10 5`, val: "2 0 3"},
+		{s: `io = 1`, val: "1"},
+		{s: `io = 2`, err: `DOMAIN ERROR: io must be 0 or 1`},
+		{s: `io`, val: "1"},
+		{s: `iota -1`, err: `DOMAIN ERROR: iota`},
+		{s: `iota 1.5`, err: `DOMAIN ERROR: iota`},
+		{s: `iota 2 3`, err: `LENGTH ERROR: iota`},
+		{s: `iota 2 2 shape 1`, err: `RANK ERROR: iota`},
+		{s: `(2 2 shape 1) iota 1`, err: `RANK ERROR: iota`},
+		{s: `iota 1000000000`, err: `LIMIT ERROR: iota`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_AssignValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `a = 1 2 3`, val: "1 2 3"},
+		{s: `a`, val: "1 2 3"},
+		{s: `b = a + 1`, val: "2 3 4"},
+		{s: `ac = +/ b`, val: "9"},
+		{s: `a = b = 0`, val: "0"},
+		{s: `a + b`, val: "0"},
+		{s: `1 + a = 5`, val: "6"},
+		{s: `a`, val: "5"},
+		{s: `a = (b = 2) * 3`, val: "6"},
+		{s: `a + b`, val: "8"},
+		{s: `y = 2 * iota 5`, val: "2 4 6 8 10"},
+		{s: `y[2] = y[1] = 7`, val: "7"},
+		{s: `y`, val: "7 7 6 8 10"},
+		{s: `1 = 2`, err: `SYNTAX ERROR: only a variable can be assigned`},
+		{s: `a = `, err: `SYNTAX ERROR`},
+		{s: `a = undefined`, err: `VALUE ERROR: undefined is undefined`},
+		{s: `io = 1 2`, err: `DOMAIN ERROR: io must be 0 or 1`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_StrandValues(t *testing.T) {
+	var tests = []struct {
+		s    string
+		expr Expression
+		err  string
+	}{
+		{s: `a = 1`, expr: Int(1)},
+		{s: `1 2 a`, expr: Vector{Int(1), Int(2), Int(1)}},
+		{s: `a 2 a`, expr: Vector{Int(1), Int(2), Int(1)}},
+		{s: `a (a + 1) 3`, expr: Vector{Int(1), Int(2), Int(3)}},
+		{s: `b = 2 3`, expr: Vector{Int(2), Int(3)}},
+		{s: `1 b`, expr: Vector{Int(1), Box{Ints{shape: []int{2}, data: []int64{2, 3}}}}},
+		{s: `b b`, expr: Vector{Box{Ints{shape: []int{2}, data: []int64{2, 3}}}, Box{Ints{shape: []int{2}, data: []int64{2, 3}}}}},
+		{s: `(1 2) (3 4)`, expr: Vector{Box{Ints{shape: []int{2}, data: []int64{1, 2}}}, Box{Ints{shape: []int{2}, data: []int64{3, 4}}}}},
+		{s: `b[1] a`, expr: Vector{Int(2), Int(1)}},
+		{s: `1 a + 1`, expr: Vector{Int(2), Int(2)}},
+		{s: `+/ 1 2 a`, expr: Int(4)},
+		{s: `1 nothere`, err: `VALUE ERROR: nothere is undefined`},
+		{s: `1 a = 2`, err: `SYNTAX ERROR: only a variable can be assigned`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q value mismatch:\nexp=%#v\ngot=%#v", i, tt.s, exp, got)
+		}
+	}
+}
+
+func TestParser_NestedValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `1 2 3`, val: "1 2 3"},
+		{s: `1 (2 3) 4`, val: "1 (2 3) 4"},
+		{s: `1 (2 2 shape 1)`, val: "1 (2 2 shape 1 1 1 1)"},
+		{s: `2 2 shape (1 2) 3 4 (5 6)`, val: "(1 2)     3\n    4 (5 6)"},
+		{s: `enclose 1 2`, val: "(1 2)"},
+		{s: `enclose enclose 1 2`, val: "((1 2))"},
+		{s: `enclose 1`, val: "1"},
+		{s: `enclose 'a'`, val: "a"},
+		{s: `depth enclose 'a'`, val: "0"},
+		{s: `dim enclose 1 2`, val: ""},
+		{s: `(enclose 1 2) 3`, val: "(1 2) 3"},
+		{s: `3 shape enclose 1 2`, val: "(1 2) (1 2) (1 2)"},
+		{s: `disclose enclose 1 2`, val: "1 2"},
+		{s: `disclose 1 2`, val: "1 2"},
+		{s: `disclose (1 2) (3 4 5)`, val: "1 2 0\n3 4 5"},
+		{s: `disclose 1 (2 3)`, val: "1 0\n2 3"},
+		{s: `dim disclose (2 2 shape 1) (1 2 3)`, val: "2 2 3"},
+		{s: `first (1 2) 3`, val: "1 2"},
+		{s: `first 5 6`, val: "5"},
+		{s: `first enclose 1 2`, val: "1 2"},
+		{s: `first iota 0`, val: "0"},
+		{s: `depth 1`, val: "0"},
+		{s: `depth 1 2`, val: "1"},
+		{s: `depth 1 (2 3)`, val: "2"},
+		{s: `depth enclose enclose 1 2`, val: "3"},
+		{s: `depth (1 (2 3)) 4`, val: "3"},
+		{s: `(1 2) (3 4) + 1`, val: "(2 3) (4 5)"},
+		{s: `10 20 + (1 2) 3`, val: "(11 12) 23"},
+		{s: `(1 2) 3 * (1 2) 3`, val: "(1 4) 9"},
+		{s: `+/ (1 2) (3 4)`, val: "(4 6)"},
+		{s: `mag (1 -2) ¯3`, val: "(1 2) 3"},
+		{s: `(1 2) (3 4) iota enclose 3 4`, val: "2"},
+		{s: `((1 2) 3)[1]`, val: "(1 2)"},
+		{s: `(1 2) 3 + (1 2 3) 4`, err: `LENGTH ERROR: +: vectors of length 2 and 3`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_CharValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `'abc'`, val: "abc"},
+		{s: `"abc"`, val: "abc"},
+		{s: `'it''s'`, val: "it's"},
+		{s: `"say ""hi"""`, val: `say "hi"`},
+		{s: `'a'`, val: "a"},
+		{s: `dim 'a'`, val: ""},
+		{s: `dim 'abc'`, val: "3"},
+		{s: `dim ''`, val: "0"},
+		{s: `first ''`, val: " "},
+		{s: `5 shape ''`, val: "     "},
+		{s: `dim 0 shape 'abc'`, val: "0"},
+		{s: `3 shape 0 shape 'abc'`, val: "   "},
+		{s: `first iota 0`, val: "0"},
+		{s: `3 shape iota 0`, val: "0 0 0"},
+		{s: `disclose 'ab' ''`, val: "ab\n  "},
+		{s: `'a' 'b' 'c'`, val: "abc"},
+		{s: `'ab' 'cd'`, val: "(ab) (cd)"},
+		{s: `1 'a' 2`, val: "1 a 2"},
+		{s: `2 3 shape 'abcdef'`, val: "abc\ndef"},
+		{s: `'hello'[1]`, val: "h"},
+		{s: `'hello'[1 5]`, val: "ho"},
+		{s: `'hello'[-3:]`, val: "llo"},
+		{s: `'hello' iota 'l'`, val: "3"},
+		{s: `'hello' iota 'lox'`, val: "3 5 6"},
+		{s: `1 2 3 iota 'a'`, val: "4"},
+		{s: `disclose 'ab' 'cde'`, val: "ab \ncde"},
+		{s: `depth 'ab' 'cd'`, val: "2"},
+		{s: `w = 'word'`, val: "word"},
+		{s: `w[1] = 'W'`, val: "W"},
+		{s: `w`, val: "Word"},
+		{s: `'abc' + 1`, err: `DOMAIN ERROR: +: arguments must be numbers`},
+		{s: `1 * 'a'`, err: `DOMAIN ERROR: *: arguments must be numbers`},
+		{s: `mag 'a'`, err: `DOMAIN ERROR: mag`},
+		{s: `+/ 'abc'`, err: `DOMAIN ERROR`},
+		{s: `'abc`, err: `SYNTAX ERROR`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_ComparisonValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `1 2 3 == 1 5 3`, val: "1 0 1"},
+		{s: `1 2 3 != 2`, val: "1 0 1"},
+		{s: `1 2 3 < 2`, val: "1 0 0"},
+		{s: `1 2 3 <= 2`, val: "1 1 0"},
+		{s: `2 > 1 2 3`, val: "1 0 0"},
+		{s: `2 >= 1 2 3`, val: "1 1 0"},
+		{s: `1 2 3 ≠ 2`, val: "1 0 1"},
+		{s: `1 2 3 ≤ 2`, val: "1 1 0"},
+		{s: `2 ≥ 1 2 3`, val: "1 1 0"},
+		{s: `+/ 1 2 3 4 5 ≤ 2`, val: "2"},
+		{s: `1 == 1.0`, val: "1"},
+		{s: `(1 / 2) == .5`, val: "1"},
+		{s: `(1 / 3) < .5`, val: "1"},
+		{s: `(2 ** 100) > 2 ** 99`, val: "1"},
+		{s: `3j4 == 3j4`, val: "1"},
+		{s: `'abc' == 'abd'`, val: "1 1 0"},
+		{s: `'a' != 1`, val: "1"},
+		{s: `(1 2) 3 == 1 3`, val: "(1 0) 1"},
+		{s: `(2 2 shape 1 2 3 4) > 2`, val: "0 0\n1 1"},
+		{s: `a = 1 == 1`, val: "1"},
+		{s: `+/ 1 2 3 4 5 > 2`, val: "3"},
+		{s: `1 1 0 1 and 1 0 1 1`, val: "1 0 0 1"},
+		{s: `1 1 0 1 or 1 0 1 1`, val: "1 1 1 1"},
+		{s: `1 1 0 0 nand 1 0 1 0`, val: "0 1 1 1"},
+		{s: `1 1 0 0 nor 1 0 1 0`, val: "0 0 0 1"},
+		{s: `not 1 0`, val: "0 1"},
+		{s: `not 1.0`, val: "0"},
+		{s: `1 2 3 and 1`, err: `DOMAIN ERROR: and: arguments must be booleans`},
+		{s: `'a' or 1`, err: `DOMAIN ERROR: or: arguments must be booleans`},
+		{s: `not 2`, err: `DOMAIN ERROR: not: argument must be a boolean`},
+		{s: `'a' < 'b'`, err: `DOMAIN ERROR: <: arguments must be numbers`},
+		{s: `1j1 < 2`, err: `DOMAIN ERROR: <: complex numbers are not ordered`},
+		{s: `1 2 == 1 2 3`, err: `LENGTH ERROR: ==: vectors of length 2 and 3`},
+		{s: `1 and`, err: `SYNTAX ERROR`},
+		{s: `and 1`, err: `SYNTAX ERROR`},
 	}
 
 	for i, tt := range tests {
-		expr, err := NewParser(strings.NewReader(tt.s)).Parse()
+		got, err := eval(tt.s)
 		if !strings.Contains(errstring(err), tt.err) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
-		} else if tt.err == "" && !reflect.DeepEqual(tt.expr.Evaluate(), (*expr).Evaluate()) {
-			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, tt.expr.Evaluate(), (*expr).Evaluate())
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
 		}
 	}
 }
 
+func TestParser_ReduceValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `or/ 1 0 1 1`, val: "1"},
+		{s: `and/ 1 0 0 0`, val: "0"},
+		{s: `max/ 1 2 4 2`, val: "4"},
+		{s: `min/ 1 2 4 3`, val: "1"},
+		{s: `-/ 1 2 3`, val: "2"},
+		{s: `// 1 2 4`, val: "2"},
+		{s: `**/ 2 3 2`, val: "512"},
+		{s: `==/ 1 1 1`, val: "1"},
+		{s: `-\ 1 2 3`, val: "1 -1 2"},
+		{s: `max\ 3 1 4 1 5`, val: "3 3 4 4 5"},
+		{s: `+/ 5`, val: "5"},
+		{s: `+/ iota 0`, val: "0"},
+		{s: `*/ iota 0`, val: "1"},
+		{s: `and/ iota 0`, val: "1"},
+		{s: `max/ iota 0`, val: "-Inf"},
+		{s: `+\ iota 0`, val: ""},
+		{s: `+/ 2 3 shape iota 6`, val: "6 15"},
+		{s: `+/[2] 2 3 shape iota 6`, val: "6 15"},
+		{s: `+/[1] 2 3 shape iota 6`, val: "5 7 9"},
+		{s: `+\ 2 3 shape iota 6`, val: "1 3  6\n4 9 15"},
+		{s: `+\[1] 2 3 shape iota 6`, val: "1 2 3\n5 7 9"},
+		{s: `+/[2] 2 3 4 shape iota 24`, val: "15 18 21 24\n51 54 57 60"},
+		{s: `+/ 0 3 shape 1`, val: ""},
+		{s: `dim +/[1] 0 3 shape 1`, val: "3"},
+		{s: `+/[1] 0 3 shape 1`, val: "0 0 0"},
+		{s: `+/ (1 2) (3 4)`, val: "(4 6)"},
+		{s: `+/ 1 2 3 + 1`, val: "9"},
+		{s: `*\ 1 2 3 4`, val: "1 2 6 24"},
+		{s: `min\ 3 1 4 0 5`, val: "3 1 1 0 0"},
+		{s: `or\ 0 0 1 0`, val: "0 0 1 1"},
+		{s: `/\ 1 2 4`, val: "1 1/2 2"},
+		{s: `(+\ iota 1000000)[-1]`, val: "500000500000"},
+		{s: `+\ (1 2) (3 4)`, val: "(1 2) (4 6)"},
+		{s: `nand/ iota 0`, err: `DOMAIN ERROR: nand/: nand has no identity element`},
+		{s: `+/[3] 2 3 shape 1`, err: `INDEX ERROR: +/: axis 3 out of range`},
+		{s: `+/[1.5] 1 2`, err: `DOMAIN ERROR: +/: axis must be an integer`},
+		{s: `and/ 1 2`, err: `DOMAIN ERROR: and`},
+		{s: `dim/ 1 2`, err: `SYNTAX ERROR`},
+		{s: `+/[1 2`, err: `SYNTAX ERROR`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_OuterValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `(iota 3) ∘.== iota 3`, val: "1 0 0\n0 1 0\n0 0 1"},
+		{s: `(iota 3) ∘.* iota 4`, val: "1 2 3  4\n2 4 6  8\n3 6 9 12"},
+		{s: `1 2 ∘.+ 10`, val: "11 12"},
+		{s: `10 ∘.+ 1 2`, val: "11 12"},
+		{s: `10 ∘.- 1`, val: "9"},
+		{s: `dim (iota 3) ∘.- 2 2 shape iota 4`, val: "3 2 2"},
+		{s: `dim (iota 0) ∘.+ 1 2`, val: "0 2"},
+		{s: `1 2 ∘.max 0 3`, val: "1 3\n2 3"},
+		{s: `(1 2) (3 4) ∘.+ 10 20`, val: "(11 12) (21 22)\n(13 14) (23 24)"},
+		{s: `2 ∘.shape 1 2`, val: "(1 1) (2 2)"},
+		{s: `+/ (iota 3) ∘.< iota 3`, val: "2 1 0"},
+		{s: `1 2 ∘.+ 'ab'`, err: `DOMAIN ERROR: +: arguments must be numbers`},
+		{s: `1 ∘+ 2`, err: `SYNTAX ERROR: found "+", expected '.'`},
+		{s: `1 ∘.dim 2`, err: `SYNTAX ERROR: found "dim", expected a dyadic function`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_InnerValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `(2 2 shape 1 2 3 4) +.* 2 2 shape 5 6 7 8`, val: "19 22\n43 50"},
+		{s: `(2 2 shape 1 2 3 4) -.* 2 2 shape 5 6 7 8`, val: " -9 -10\n-13 -14"},
+		{s: `1 2 3 +.* 4 5 6`, val: "32"},
+		{s: `2 +.* 1 2 3`, val: "12"},
+		{s: `1 2 3 +.* 2`, val: "12"},
+		{s: `(2 3 shape iota 6) +.* 1 2 3`, val: "14 32"},
+		{s: `1 2 +.* 2 3 shape iota 6`, val: "9 12 15"},
+		{s: `(2 2 shape 1.5) +.* 2 2 shape 2`, val: "6 6\n6 6"},
+		{s: `(2 2 shape 1 0 0 1) +.* 2 2 shape 9223372036854775807`, val: "9223372036854775807 9223372036854775807\n9223372036854775807 9223372036854775807"},
+		{s: `(2 2 shape 1) +.* 2 2 shape 9223372036854775807`, val: "18446744073709551614 18446744073709551614\n18446744073709551614 18446744073709551614"},
+		{s: `dim (2 3 4 shape 1) +.* 4 5 shape 1`, val: "2 3 5"},
+		{s: `(iota 0) +.* iota 0`, val: "0"},
+		{s: `(2 3 shape 1 2 3 4 5 6) and.== 1 2 3`, val: "1 0"},
+		{s: `(3 3 shape 0 1 0 0 0 1 0 0 0) or.and 3 3 shape 0 1 0 0 0 1 0 0 0`, val: "0 0 1\n0 0 0\n0 0 0"},
+		{s: `1 2 max.+ 3 4`, val: "6"},
+		{s: `1 2 +.* 1 2 3`, err: `LENGTH ERROR: +.*: vectors of length 2 and 3`},
+		{s: `(2 2 shape 1) +.* 3 2 shape 1`, err: `LENGTH ERROR: +.*: arrays of shape [2 2] and [3 2]`},
+		// the arguments may have any rank, an error of 'f' or 'g' is their own.
+		{s: `dim (2 2 3 shape 1) +.* 3 2 2 shape 1`, val: "2 2 2 2"},
+		{s: `(enclose 2 2 shape 1) +.* enclose 1 2`, err: `RANK ERROR: *: arrays of rank 2 and 1`},
+		{s: `(iota 0) nand.and iota 0`, err: `DOMAIN ERROR: nand.and: nand has no identity element`},
+		{s: `1 2 +.dim 3`, err: `SYNTAX ERROR: found "dim", expected a dyadic function`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_EachValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `dim¨ (1 2) (3 4 5)`, val: "(2) (3)"},
+		{s: `iota¨ 1 2 3`, val: "(1) (1 2) (1 2 3)"},
+		{s: `iota¨ 3`, val: "(1 2 3)"},
+		{s: `first¨ (1 2) (3 4)`, val: "1 3"},
+		{s: `depth¨ 1 (2 3)`, val: "0 1"},
+		{s: `dim dim¨ 2 2 shape (1 2) (3 4 5) 6 (7 8)`, val: "2 2"},
+		{s: `1 2 shape¨ 3 4`, val: "(3) (4 4)"},
+		{s: `(1 2) (3 4) +¨ 10`, val: "(11 12) (13 14)"},
+		{s: `10 +¨ (1 2) (3 4)`, val: "(11 12) (13 14)"},
+		{s: `(1 2) (3 4) iota¨ 2 4`, val: "2 2"},
+		{s: `(iota 0) +¨ iota 0`, val: ""},
+		{s: `+/ dim¨ (1 2) (3 4 5)`, val: "(5)"},
+		{s: `1 2 +¨ 1 2 3`, err: `LENGTH ERROR: +¨: vectors of length 2 and 3`},
+		{s: `1 2 +¨ 2 2 shape 1`, err: `RANK ERROR: +¨: arrays of rank 1 and 2`},
+		{s: `(1 2) (3 4) +¨ (1 2 3) 4`, err: `LENGTH ERROR: +: vectors of length 2 and 3`},
+		{s: `+¨ 1 2`, err: `SYNTAX ERROR: found "+", expected a monadic function`},
+		{s: `1 dim¨ 2`, err: `SYNTAX ERROR: found "dim", expected a dyadic operator`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_FunctionValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `favg = {(+/⍵) / dim ⍵}`, val: "{(+/⍵) / dim ⍵}"},
+		{s: `favg 1 2 3 4`, val: "5/2"},
+		{s: `favg favg¨ (1 2) (3 4 5)`, val: "(11/4)"},
+		{s: `favg`, val: "{(+/⍵) / dim ⍵}"},
+		{s: `fpow = {⍺ ** ⍵}`, val: "{⍺ ** ⍵}"},
+		{s: `2 fpow 10`, val: "1024"},
+		{s: `1 2 fpow 3`, val: "1 8"},
+		{s: `1 {⍺ + ⍵} 2`, val: "3"},
+		{s: `{⍵ * 2} 1 2 3`, val: "2 4 6"},
+		{s: `{⍵[2]} 4 5 6`, val: "5"},
+		{s: `{⍵-1} 5`, val: "4"},
+		{s: `{io = 0 ⋄ iota 3} 0`, err: `SYNTAX ERROR: io can not be assigned in a function`},
+		{s: `{io + iota 3} 0`, val: "2 3 4"},
+		{s: `ffact = {⍵ <= 1: 1 ⋄ ⍵ * ∇ ⍵ - 1}`, val: "{⍵ <= 1: 1 ⋄ ⍵ * ∇ ⍵ - 1}"},
+		{s: `ffact 20`, val: "2432902008176640000"},
+		{s: `ffact¨ iota 5`, val: "1 2 6 24 120"},
+		{s: `{⍵ <= 1: ⍵ ⋄ (∇ ⍵ - 1) + ∇ ⍵ - 2} 15`, val: "610"},
+		{s: `{fy = ⍵ * 2 ⋄ fy + 1} 5`, val: "11"},
+		{s: `fy`, err: `VALUE ERROR: fy is undefined`},
+		{s: `fx = 10`, val: "10"},
+		{s: `faddx = {⍵ + fx}`, val: "{⍵ + fx}"},
+		{s: `faddx 1`, val: "11"},
+		{s: `fv = 1 2 3`, val: "1 2 3"},
+		{s: `{fv[1] = 100 ⋄ fv} 0`, val: "100 2 3"},
+		{s: `fv`, val: "1 2 3"},
+		{s: `fadder = {fn = ⍵ ⋄ {⍵ + fn}}`, val: "{fn = ⍵ ⋄ {⍵ + fn}}"},
+		{s: `fadd3 = fadder 3`, val: "{⍵ + fn}"},
+		{s: `fadd3 10`, val: "13"},
+		{s: `fg = favg`, val: "{(+/⍵) / dim ⍵}"},
+		{s: `fg 2 4`, val: "3"},
+		{s: `fcall = {flater ⍵}`, val: "{flater ⍵}"},
+		{s: `flater = {⍵ + 1}`, val: "{⍵ + 1}"},
+		{s: `fcall 1`, val: "2"},
+		{s: `feven = {⍵ == 0: 1 ⋄ fodd ⍵ - 1}`, val: "{⍵ == 0: 1 ⋄ fodd ⍵ - 1}"},
+		{s: `fodd = {⍵ == 0: 0 ⋄ feven ⍵ - 1}`, val: "{⍵ == 0: 0 ⋄ feven ⍵ - 1}"},
+		{s: `feven 4`, val: "1"},
+		{s: `feven¨ iota 5`, val: "0 1 0 1 0"},
+		{s: `flater = 10`, val: "10"},
+		{s: `fcall 1`, val: "10 1"},
+		{s: `(fadder 3) 1`, err: `SYNTAX ERROR: fadder 3 is a function, not an item of an array`},
+		{s: `{⍺ + ⍵}/ 1 2 3`, val: "6"},
+		{s: `{⍺ - ⍵}/ 1 2 3`, val: "2"},
+		{s: `{⍺ - ⍵}\ 1 2 3`, val: "1 -1 2"},
+		{s: `fpow/ 2 3 2`, val: "512"},
+		{s: `{⍺ + ⍵}/[1] 2 2 shape iota 4`, val: "4 6"},
+		{s: `(iota 3) ∘.{⍺ * 10 + ⍵} iota 2`, val: "11 12\n22 24\n33 36"},
+		{s: `(2 2 shape iota 4) {⍺ + ⍵}.* 2 2 shape iota 4`, val: " 7 10\n15 22"},
+		{s: `1 2 +.fpow 3 4`, val: "17"},
+		{s: `1 2 fpow¨ 3 4`, val: "1 16"},
+		{s: `{fl = ⍵ ⋄ fl = fl + 1}/ 5`, val: "5"},
+		{s: `{fl = ⍵ ⋄ fl = fl + 1} 5`, val: "6"},
+		{s: `{⍺ + ⍵}/ iota 0`, err: `DOMAIN ERROR: {⍺ + ⍵}/: {⍺ + ⍵} has no identity element`},
+		{s: `{⍺ + ⍵} 1`, err: `VALUE ERROR: ⍺ is undefined`},
+		{s: `{1 2: 3} 1`, err: `DOMAIN ERROR: condition must be 0 or 1`},
+		{s: `{0: 3} 1`, err: `VALUE ERROR: function has no result`},
+		{s: `{∇ ⍵} 1`, err: `LIMIT ERROR: ∇: too many nested calls`},
+		{s: `{} 1`, err: `SYNTAX ERROR: found "}", expected number or identifier`},
+		{s: `{1 2`, err: `SYNTAX ERROR: found "", expected '⋄' or '}'`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_PackedValues(t *testing.T) {
+	var tests = []struct {
+		s    string
+		expr Expression
+		err  string
+	}{
+		{s: `1 2 3`, expr: Ints{shape: []int{3}, data: []int64{1, 2, 3}}},
+		{s: `1 0 1`, expr: Bools{shape: []int{3}, data: []bool{true, false, true}}},
+		{s: `1.5 .5`, expr: Floats{shape: []int{2}, data: []float64{1.5, .5}}},
+		{s: `1.5 1`, expr: Vector{Float(1.5), Int(1)}},
+		{s: `iota 3`, expr: Ints{shape: []int{3}, data: []int64{1, 2, 3}}},
+		{s: `iota 0`, expr: Vector{}},
+		{s: `2 2 shape 1 2 3 4`, expr: Ints{shape: []int{2, 2}, data: []int64{1, 2, 3, 4}}},
+		{s: `1 2 3 + 1`, expr: Ints{shape: []int{3}, data: []int64{2, 3, 4}}},
+		{s: `1 2 2 - 1`, expr: Bools{shape: []int{3}, data: []bool{false, true, true}}},
+		{s: `1 2 3 * .5`, expr: Floats{shape: []int{3}, data: []float64{.5, 1, 1.5}}},
+		{s: `1 2 / 2`, expr: Vector{Rational{big.NewRat(1, 2)}, Int(1)}},
+		{s: `1 2 3 > 2`, expr: Bools{shape: []int{3}, data: []bool{false, false, true}}},
+		{s: `1 0 1 or 0 0 1`, expr: Bools{shape: []int{3}, data: []bool{true, false, true}}},
+		{s: `+/ 2 3 shape iota 6`, expr: Ints{shape: []int{2}, data: []int64{6, 15}}},
+		{s: `+\ 1 2 3`, expr: Ints{shape: []int{3}, data: []int64{1, 3, 6}}},
+		{s: `max/ 1.5 2.5 .5`, expr: Float(2.5)},
+		{s: `(2 ** 62) 1 + (2 ** 62) 1`, expr: Vector{BigInt{new(big.Int).Lsh(big.NewInt(1), 63)}, Int(2)}},
+		{s: `+/ (2 ** 62) (2 ** 62)`, expr: BigInt{new(big.Int).Lsh(big.NewInt(1), 63)}},
+		{s: `(10 20 30 40)[-2 -1]`, expr: Ints{shape: []int{2}, data: []int64{30, 40}}},
+		{s: `(1.5 2.5)[-1]`, expr: Float(2.5)},
+		{s: `(1 0 1)[-1 -2]`, expr: Bools{shape: []int{2}, data: []bool{true, false}}},
+		{s: `(2 2 shape 1 2 3 4)[-1;]`, expr: Ints{shape: []int{2}, data: []int64{3, 4}}},
+		{s: `py = 10 20 30`, expr: Ints{shape: []int{3}, data: []int64{10, 20, 30}}},
+		{s: `py[-1] = 0`, expr: Int(0)},
+		{s: `py`, expr: Ints{shape: []int{3}, data: []int64{10, 20, 0}}},
+		{s: `py[-2 -1] = 1 0`, expr: Bools{shape: []int{2}, data: []bool{true, false}}},
+		{s: `py`, expr: Ints{shape: []int{3}, data: []int64{10, 1, 0}}},
+		{s: `py[-1] = .5`, expr: Float(.5)},
+		{s: `py`, expr: Vector{Int(10), Int(1), Float(.5)}},
+		{s: `2 2 shape 1.5`, expr: Floats{shape: []int{2, 2}, data: []float64{1.5, 1.5, 1.5, 1.5}}},
+		{s: `3 shape 1 0`, expr: Bools{shape: []int{3}, data: []bool{true, false, true}}},
+		{s: `2 shape 5 6 7`, expr: Ints{shape: []int{2}, data: []int64{5, 6}}},
+		{s: `10 20 30 iota 30 5`, expr: Ints{shape: []int{2}, data: []int64{3, 4}}},
+		{s: `1 0 iota 2 2 shape 0 1`, expr: Ints{shape: []int{2, 2}, data: []int64{2, 1, 2, 1}}},
+		{s: `1 2 / 0`, err: `DOMAIN ERROR: /: division by zero`},
+		{s: `1 2 and 1`, err: `DOMAIN ERROR: and`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q value mismatch:\nexp=%#v\ngot=%#v", i, tt.s, exp, got)
+		}
+	}
+}
+
+func TestParser_PackedBoxedValues(t *testing.T) {
+	var tests = []struct {
+		packed string
+		boxed  string
+		val    string
+	}{
+		{packed: `+/ 1. 1e16 -1e16`, boxed: `+/ 1 1e16 -1e16`, val: "1"},
+		{packed: `+/ 1e16 -1e16 1.`, boxed: `+/ 1e16 -1e16 1`, val: "0"},
+		{packed: `+/ 1. 1e16 -1e16 0. 0. 0.`, boxed: `+/ 1 1e16 -1e16 0 0 0`, val: "1"},
+		{packed: `+/[1] 3 1 shape 1. 1e16 -1e16`, boxed: `+/[1] 3 1 shape 1 1e16 -1e16`, val: "1"},
+		{packed: `1. 1e16 -1e16 +.* 1. 1. 1.`, boxed: `1 1e16 -1e16 +.* 1 1 1`, val: "1"},
+		{packed: `+\ 1. 1e16 -1e16`, boxed: `+\ 1 1e16 -1e16`, val: "1 1e+16 0"},
+	}
+
+	defer func(n int) { parallelThreshold = n }(parallelThreshold)
+	for _, threshold := range []int{1 << 16, 2} {
+		parallelThreshold = threshold
+		for i, tt := range tests {
+			packed, err := eval(tt.packed)
+			if err != nil {
+				t.Errorf("%d. %q threshold %d: unexpected error: %s", i, tt.packed, threshold, err)
+				continue
+			}
+			boxed, err := eval(tt.boxed)
+			if err != nil {
+				t.Errorf("%d. %q threshold %d: unexpected error: %s", i, tt.boxed, threshold, err)
+				continue
+			}
+			if packed.String() != tt.val || boxed.String() != tt.val {
+				t.Errorf("%d. %q threshold %d: value mismatch:\nexp=%s\npacked=%s\nboxed=%s", i, tt.packed, threshold, tt.val, packed, boxed)
+			}
+		}
+	}
+}
+
+func TestParser_ParallelValues(t *testing.T) {
+	defer func(n int) { parallelThreshold = n }(parallelThreshold)
+
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `+/ iota 100`, val: "5050"},
+		{s: `+/ (iota 100) * .5`, val: "2525"},
+		{s: `max/ 2 - iota 100`, val: "1"},
+		{s: `and/ (iota 100) > 0`, val: "1"},
+		{s: `+/ 4 25 shape iota 100`, val: "325 950 1575 2200"},
+		{s: `+/[1] 25 4 shape iota 100`, val: "1225 1250 1275 1300"},
+		{s: `+\ iota 10`, val: "1 3 6 10 15 21 28 36 45 55"},
+		{s: `(iota 10) * iota 10`, val: "1 4 9 16 25 36 49 64 81 100"},
+		{s: `(iota 10) == 10 - iota 10`, val: "0 0 0 0 1 0 0 0 0 0"},
+		{s: `(iota 10) / 4`, val: "1/4 1/2 3/4 1 5/4 3/2 7/4 2 9/4 5/2"},
+		{s: `mag -3 4 -5 6 -7 8`, val: "3 4 5 6 7 8"},
+		{s: `{fz = ⍵ * 2 ⋄ fz + 1}¨ iota 10`, val: "3 5 7 9 11 13 15 17 19 21"},
+		{s: `+/ {⍵ <= 0: 0 ⋄ ∇ ⍵ - 1}¨ 16 shape 4000`, val: "0"},
+		{s: `(iota 3) ∘.{⍺ + ∇¨ 0 * ⍵} iota 3`, err: "LIMIT ERROR: ∇: too many nested calls"},
+		{s: `(iota 10) + 1 'a' 3 4 5 6 7 8 'b' 10`, err: "DOMAIN ERROR: +: arguments must be numbers"},
+		{s: `(iota 10) + iota 11`, err: "LENGTH ERROR: +: vectors of length 10 and 11"},
+	}
+
+	// a threshold of 0 or 1 splits the arrays in chunks of one item.
+	for _, threshold := range []int{4, 1, 0} {
+		parallelThreshold = threshold
+		for i, tt := range tests {
+			singleThread = true
+			single, serr := eval(tt.s)
+			singleThread = false
+			got, err := eval(tt.s)
+			if tt.err != errstring(err) || tt.err != errstring(serr) {
+				t.Errorf("%d. %q threshold %d: error mismatch:\n  exp=%s\n  got=%s\n  single=%s\n\n", i, tt.s, threshold, tt.err, err, serr)
+			} else if tt.err == "" && (got.String() != tt.val || !reflect.DeepEqual(got, single)) {
+				t.Errorf("%d. %q threshold %d: value mismatch:\nexp=%s\ngot=%s\nsingle=%s", i, tt.s, threshold, tt.val, got, single)
+			}
+		}
+	}
+}
+
+func TestParser_IndexValues(t *testing.T) {
+	stack["y"] = Vector{Int(2), Int(4), Int(6), Int(8), Int(10)}
+	stack["m"] = Array{shape: []int{2, 3}, data: Vector{Int(1), Int(2), Int(3), Int(4), Int(5), Int(6)}}
+
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `y[2]`, val: "4"},
+		{s: `y[-1]`, val: "10"},
+		{s: `y[-5]`, val: "2"},
+		{s: `y[:3]`, val: "2 4"},
+		{s: `y[2:]`, val: "4 6 8 10"},
+		{s: `y[-2:]`, val: "8 10"},
+		{s: `y[2:-1]`, val: "4 6 8"},
+		{s: `y[2:4]`, val: "4 6"},
+		{s: `y[:6]`, val: "2 4 6 8 10"},
+		{s: `y[6:]`, val: ""},
+		{s: `y[4:2]`, val: ""},
+		{s: `y[:]`, val: "2 4 6 8 10"},
+		{s: `y[1 3 5]`, val: "2 6 10"},
+		{s: `y[2 2 shape 1 2]`, val: "2 4\n2 4"},
+		{s: `y[1 + 1]`, val: "4"},
+		{s: `1 + y[2]`, val: "5"},
+		{s: `y[2] + 1`, val: "5"},
+		{s: `(2 * iota 5)[2]`, val: "4"},
+		{s: `(iota 5)[3:][1]`, val: "3"},
+		{s: `m[1;2]`, val: "2"},
+		{s: `m[2;]`, val: "4 5 6"},
+		{s: `m[;2]`, val: "2 5"},
+		{s: `m[2 1;1 3]`, val: "4 6\n1 3"},
+		{s: `m[;2:]`, val: "2 3\n5 6"},
+		{s: `io = 0`, val: "0"},
+		{s: `y[2]`, val: "6"},
+		{s: `y[-1]`, val: "10"},
+		{s: `y[:2]`, val: "2 4"},
+		{s: `m[0;2]`, val: "3"},
+		{s: `y[2:]`, val: "6 8 10"},
+		{s: `y[1:3]`, val: "4 6"},
+		{s: `io = 1`, val: "1"},
+		{s: `y[0]`, err: `INDEX ERROR: index`},
+		{s: `y[6]`, err: `INDEX ERROR: index`},
+		{s: `y[-6]`, err: `INDEX ERROR: index`},
+		{s: `y[:7]`, err: `INDEX ERROR: index`},
+		{s: `y[0:]`, err: `INDEX ERROR: index`},
+		{s: `y[7:]`, err: `INDEX ERROR: index`},
+		{s: `y[1.5]`, err: `DOMAIN ERROR: index`},
+		{s: `y[1;2]`, err: `RANK ERROR: index`},
+		{s: `m[1]`, err: `RANK ERROR: index`},
+		{s: `(1)[1]`, err: `RANK ERROR: index`},
+		{s: `y[1`, err: `SYNTAX ERROR`},
+		{s: `y[x]`, err: `VALUE ERROR`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_IndexAssignValues(t *testing.T) {
+	stack["y"] = Vector{Int(2), Int(4), Int(6), Int(8), Int(10)}
+	stack["m"] = Array{shape: []int{2, 3}, data: Vector{Int(1), Int(2), Int(3), Int(4), Int(5), Int(6)}}
+	stack["z"] = stack["y"]
+
+	var tests = []struct {
+		s   string
+		val string
+		err string
+	}{
+		{s: `y[2] = 10`, val: "10"},
+		{s: `y`, val: "2 10 6 8 10"},
+		{s: `z`, val: "2 4 6 8 10"},
+		{s: `y[1 3] = 0`, val: "0"},
+		{s: `y`, val: "0 10 0 8 10"},
+		{s: `y[-2:] = 1 2`, val: "1 2"},
+		{s: `y`, val: "0 10 0 1 2"},
+		{s: `y[1] = 3 * 2`, val: "6"},
+		{s: `y`, val: "6 10 0 1 2"},
+		{s: `y[1] + 1`, val: "7"},
+		{s: `y[1 2] = 1 2 3`, err: `LENGTH ERROR: index: vectors of length 2 and 3`},
+		{s: `y[1] = 1 2`, err: `RANK ERROR: index`},
+		{s: `y[6] = 1`, err: `INDEX ERROR: index`},
+		{s: `y`, val: "6 10 0 1 2"},
+		{s: `m[1;] = 0`, val: "0"},
+		{s: `m`, val: "0 0 0\n4 5 6"},
+		{s: `m[;2] = 7 8`, val: "7 8"},
+		{s: `m`, val: "0 7 0\n4 8 6"},
+		{s: `m[2;3] = 9`, val: "9"},
+		{s: `m`, val: "0 7 0\n4 8 9"},
+		{s: `m[1 2;1 3] = 2 2 shape 1 2 3 4`, val: "1 2\n3 4"},
+		{s: `m`, val: "1 7 2\n3 8 4"},
+		{s: `m[1] = 0`, err: `RANK ERROR: index`},
+		{s: `y[1][1] = 0`, err: `SYNTAX ERROR`},
+		{s: `x[1] = 0`, err: `VALUE ERROR`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" && got.String() != tt.val {
+			t.Errorf("%d. %q value mismatch:\nexp=%q\ngot=%q", i, tt.s, tt.val, got)
+		}
+	}
+}
+
+func TestParser_ParenthesesValues(t *testing.T) {
+	var tests = []struct {
+		s    string
+		expr Expression
+		err  string
+	}{
+		{s: `(1)`, expr: Int(1)},
+		{s: `(1 + 2) * 3`, expr: Int(9)},
+		{s: `3 * (1 + 2)`, expr: Int(9)},
+		{s: `(2 * 3) + 4`, expr: Int(10)},
+		{s: `((1 + 2) * (3 + 4)) - 1`, expr: Int(20)},
+		{s: `(1 2 3) + 1 1 1`, expr: Vector([]Value{Int(2), Int(3), Int(4)})},
+		{s: `1 (2 + 3) 4`, expr: Vector([]Value{Int(1), Int(5), Int(4)})},
+		{s: `(2-3)`, expr: Int(-1)},
+		{s: `1 (2-3) 4`, expr: Vector([]Value{Int(1), Int(-1), Int(4)})},
+		{s: `(1+2)-1`, expr: Int(2)},
+		{s: `(1+2) -1`, expr: Int(2)},
+		{s: `(1 + 1) (2 + 3) * 2 2`, expr: Vector([]Value{Int(4), Int(10)})},
+		{s: `+/ (1 2 3 * 1 2 3)`, expr: Int(14)},
+		{s: `(+/ 1 2 3) * 2`, expr: Int(12)},
+		{s: `(1 + 2`, err: `ERROR`},
+		{s: `1 + 2)`, err: `ERROR`},
+		{s: `()`, err: `ERROR`},
+		{s: `(`, err: `ERROR`},
+	}
+
+	for i, tt := range tests {
+		got, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if exp := value(tt.expr); tt.err == "" && !reflect.DeepEqual(exp, got) {
+			t.Errorf("%d. %q\n\nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.s, exp, got)
+		}
+	}
+}
+
+func TestParser_ErrorValues(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+		pos int
+	}{
+		{s: `1 2 3 + 1 2`, err: `LENGTH ERROR: +: vectors of length 3 and 2`, pos: 6},
+		{s: `1 2 - 1 2 3`, err: `LENGTH ERROR: -`, pos: 4},
+		{s: `1 + 1 2 3 * 1 2 3 4`, err: `LENGTH ERROR: *`, pos: 10},
+		{s: `1 2 3 max 1 2`, err: `LENGTH ERROR: max`, pos: 6},
+		{s: `1 / 0`, err: `DOMAIN ERROR: /: division by zero`, pos: 2},
+		{s: `1 2 / 1 0.`, err: `DOMAIN ERROR: /`, pos: 4},
+		{s: `0 ** -1`, err: `DOMAIN ERROR: **`, pos: 2},
+		{s: `1j1 max 1`, err: `DOMAIN ERROR: max`, pos: 4},
+		{s: `3 ** 100000000`, err: `LIMIT ERROR: **`, pos: 2},
+		{s: `1 + zz`, err: `VALUE ERROR: zz is undefined`, pos: 4},
+		{s: `+/ 1 2 3 + 1 2`, err: `LENGTH ERROR: +`, pos: 9},
+		{s: `1 2 +`, err: `SYNTAX ERROR`, pos: 5},
+		{s: `(1 + 2`, err: `SYNTAX ERROR: found "", expected ')'`, pos: 6},
+		{s: `1 + 2)`, err: `SYNTAX ERROR: found ")"`, pos: 5},
+		{s: `? 1`, err: `SYNTAX ERROR: found "?"`, pos: 0},
+		{s: `- 1`, err: `SYNTAX ERROR: found "-"`, pos: 0},
+		{s: `1 +/ 2`, err: `SYNTAX ERROR`, pos: 3},
+	}
+
+	for i, tt := range tests {
+		_, err := eval(tt.s)
+		if !strings.Contains(errstring(err), tt.err) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if e, ok := err.(*APLError); !ok {
+			t.Errorf("%d. %q: expected an APL error, got %T", i, tt.s, err)
+		} else if e.Pos.Offset != tt.pos {
+			t.Errorf("%d. %q: position mismatch: exp=%v got=%v", i, tt.s, tt.pos, e.Pos.Offset)
+		}
+	}
+}
+
+func TestParser_ErrorPositions(t *testing.T) {
+	var tests = []struct {
+		s   string
+		pos Pos
+	}{
+		{s: `1 + zz`, pos: Pos{Offset: 4, Line: 1, Column: 5}},
+		{s: "1 +\n  zz", pos: Pos{Offset: 6, Line: 2, Column: 3}},
+		{s: "1 2 3\n+\n1 2", pos: Pos{Offset: 6, Line: 2, Column: 1}},
+		{s: "(1 +\n\t2", pos: Pos{Offset: 7, Line: 2, Column: 3}},
+		{s: "1 +\n\n  zz", pos: Pos{Offset: 7, Line: 3, Column: 3}},
+	}
+
+	for i, tt := range tests {
+		_, err := eval(tt.s)
+		if e, ok := err.(*APLError); !ok {
+			t.Errorf("%d. %q: expected an APL error, got %v", i, tt.s, err)
+		} else if e.Pos != tt.pos {
+			t.Errorf("%d. %q: position mismatch: exp=%v got=%v", i, tt.s, tt.pos, e.Pos)
+		}
+	}
+}
+
+// benchmarkScan measures the scan by the dyadic function 'fname' of a vector
+// of 'n' integers.
+func benchmarkScan(b *testing.B, fname string, n int) {
+	v, err := interval(Int(n))
+	if err != nil {
+		b.Fatal(err)
+	}
+	fn := dyadic(fname)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scan(fname+"\\", fname, fn, v, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// scans of an associative function are linear.
+func BenchmarkScan_Add1e3(b *testing.B) { benchmarkScan(b, "+", 1e3) }
+func BenchmarkScan_Add1e4(b *testing.B) { benchmarkScan(b, "+", 1e4) }
+func BenchmarkScan_Add1e6(b *testing.B) { benchmarkScan(b, "+", 1e6) }
+
+// scans of a non-associative function reduce each prefix and are quadratic,
+// twice the items take four times as long.
+func BenchmarkScan_Minus1e3(b *testing.B) { benchmarkScan(b, "-", 1e3) }
+func BenchmarkScan_Minus2e3(b *testing.B) { benchmarkScan(b, "-", 2e3) }
+
+// boxedInts returns a vector of 'n' integers stored boxed, as values.
+func boxedInts(n int) Vector {
+	v := make(Vector, n)
+	for i := range v {
+		v[i] = Int(i)
+	}
+	return v
+}
+
+// packedInts returns a vector of 'n' integers stored packed.
+func packedInts(n int) Value {
+	v := make([]int64, n)
+	for i := range v {
+		v[i] = int64(i)
+	}
+	return newInts([]int{n}, v)
+}
+
+// benchmarkAdd measures the addition of the vector 'a' to itself.
+func benchmarkAdd(b *testing.B, a Value) {
+	for i := 0; i < b.N; i++ {
+		if _, err := add(a, a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkSum measures the sum of the items of the vector 'a'.
+func benchmarkSum(b *testing.B, a Value) {
+	for i := 0; i < b.N; i++ {
+		if _, err := reduce("+/", "+", add, a, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAdd_Boxed1e6(b *testing.B)  { benchmarkAdd(b, boxedInts(1e6)) }
+func BenchmarkAdd_Packed1e6(b *testing.B) { benchmarkAdd(b, packedInts(1e6)) }
+func BenchmarkSum_Boxed1e6(b *testing.B)  { benchmarkSum(b, boxedInts(1e6)) }
+func BenchmarkSum_Packed1e6(b *testing.B) { benchmarkSum(b, packedInts(1e6)) }
+
+// benchmarkMatmul measures the inner product +.* of the matrix 'a' by itself.
+func benchmarkMatmul(b *testing.B, a Value) {
+	for i := 0; i < b.N; i++ {
+		if _, err := inner("+.*", "+", "*", add, times, a, a); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMatmul_Boxed100(b *testing.B) {
+	benchmarkMatmul(b, Array{shape: []int{100, 100}, data: boxedInts(1e4)})
+}
+func BenchmarkMatmul_Packed100(b *testing.B) {
+	benchmarkMatmul(b, Ints{shape: []int{100, 100}, data: packedInts(1e4).(Ints).data})
+}
+
+// benchmarkSingle measures the benchmark 'fn' on a single goroutine.
+func benchmarkSingle(b *testing.B, fn func(*testing.B, Value), a Value) {
+	defer func() { singleThread = false }()
+	singleThread = true
+	fn(b, a)
+}
+
+func BenchmarkAdd_Single1e6(b *testing.B) { benchmarkSingle(b, benchmarkAdd, packedInts(1e6)) }
+func BenchmarkSum_Single1e6(b *testing.B) { benchmarkSingle(b, benchmarkSum, packedInts(1e6)) }
+
+// eval parses and evaluates the string passed as param.
+func eval(s string) (Value, error) {
+	expr, err := NewParser(strings.NewReader(s)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return (*expr).Evaluate()
+}
+
+// value returns the value of the expression, nil if there is none.
+func value(expr Expression) Value {
+	if expr == nil {
+		return nil
+	}
+	v, _ := expr.Evaluate()
+	return v
+}
+
 // errstring returns the string representation of an error.
 func errstring(err error) string {
 	if err != nil {
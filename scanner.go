@@ -8,28 +8,72 @@ import (
 
 // Scanner represents a lexical scanner
 type Scanner struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	pos    Pos   // position of the next rune
+	prev   Pos   // position of the last read rune
+	last   Token // last token scanned other than a space
+	spaced bool  // whether a space was scanned after the last token
 }
 
 // NewScanner returns a new instance of Scanner.
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+	return &Scanner{r: bufio.NewReader(r), pos: Pos{Line: 1, Column: 1}}
 }
 
 // read reads the next rune from the bufferred reader.
 // Returns the rune(0) if an error occurs (or io.EOF is returned)
 func (s *Scanner) read() rune {
-	r, _, err := s.r.ReadRune()
+	r, size, err := s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
+	s.prev = s.pos
+	s.pos.Offset += size
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return r
 }
 
-func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+// unread pushes the last read rune back onto the bufferred reader.
+func (s *Scanner) unread() {
+	if err := s.r.UnreadRune(); err == nil {
+		s.pos = s.prev
+	}
+}
+
+// peek returns the next rune without consuming it.
+// Returns the rune(0) if an error occurs (or io.EOF is returned)
+func (s *Scanner) peek() rune {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return eof
+	}
+	return rune(b[0])
+}
+
+// Scan returns the next token, literal value and the position where the
+// token starts.
+func (s *Scanner) Scan() (t Token, lit string, pos Pos) {
+	pos = s.pos
+	t, lit = s.scan()
+	if t != Space {
+		s.last = t
+	}
+	s.spaced = t == Space
+	return
+}
+
+// scan returns the next token and literal value.
+func (s *Scanner) scan() (t Token, lit string) {
+	// if we see a number then consume it.
+	if s.isNumberAhead() {
+		return s.scanDigit()
+	}
 
-// Scan returns the next token and literal value.
-func (s *Scanner) Scan() (t Token, lit string) {
 	// read the next rune.
 	r := s.read()
 	sr := string(r)
@@ -46,9 +90,6 @@ func (s *Scanner) Scan() (t Token, lit string) {
 			return
 		}
 		sr = lit
-	} else if isDigit(r) {
-		s.unread()
-		return s.scanDigit()
 	}
 
 	// rune cases
@@ -56,33 +97,86 @@ func (s *Scanner) Scan() (t Token, lit string) {
 	case eof:
 		return EOF, ""
 	case '+':
-		// check +\ and +/ cases
-		r1 := s.read()
-		if r1 == '\\' {
-			return Operator, "+\\"
-		} else if r1 == '/' {
-			return Operator, "+/"
-		}
-		s.unread()
 		return Operator, string(r)
 	case '-':
+		// a '-' sign right next to a number is a negative number: -1 -.5
+		// whereas '- 1' is the '-' operator followed by a number.
+		// After an operand it is the '-' operator: a-1 a -1 (1)-1 2-1
+		// except for a number followed by a space that starts a vector: 1 -2
+		if s.isNumberAhead() && !s.afterOperand() {
+			t, lit = s.scanDigit()
+			return t, "-" + lit
+		}
 		return Operator, string(r)
-	case '/':
+	case '¯':
+		// the high minus always makes a negative number: a ¯1 (1) ¯2
+		if s.isNumberAhead() {
+			t, lit = s.scanDigit()
+			return t, "-" + lit
+		}
+	case '/', '\\':
 		return Operator, string(r)
 	case '*':
-		r1 := s.read()
-		// todo(santiaago): is there a more intelligent way of doing this?
-		if r1 == '*' {
+		if s.peek() == '*' {
+			s.read()
 			return Operator, "**"
-		} else if r1 == '\\' {
-			return Operator, "*\\"
-		} else if r1 == '/' {
-			return Operator, "*/"
 		}
-		s.unread()
 		return Operator, string(r)
 	case '=':
+		// '==' is the equality function, '=' alone is an assignment.
+		if s.peek() == '=' {
+			s.read()
+			return Operator, "=="
+		}
 		return Assign, string(r)
+	case '!':
+		if s.peek() == '=' {
+			s.read()
+			return Operator, "!="
+		}
+	case '<', '>':
+		if s.peek() == '=' {
+			s.read()
+			return Operator, string(r) + "="
+		}
+		return Operator, string(r)
+	case '≠':
+		// the APL glyphs are scanned as the functions they stand for.
+		return Operator, "!="
+	case '≤':
+		return Operator, "<="
+	case '≥':
+		return Operator, ">="
+	case '(':
+		return LeftParen, string(r)
+	case ')':
+		return RightParen, string(r)
+	case '[':
+		return LeftBracket, string(r)
+	case ']':
+		return RightBracket, string(r)
+	case ':':
+		return Colon, string(r)
+	case ';':
+		return Semicolon, string(r)
+	case '∘':
+		return Jot, string(r)
+	case '.':
+		return Dot, string(r)
+	case '¨':
+		return Diaeresis, string(r)
+	case '{':
+		return LeftBrace, string(r)
+	case '}':
+		return RightBrace, string(r)
+	case '⋄':
+		return Diamond, string(r)
+	case '⍺', '⍵', '∇':
+		// the arguments of a function and the function itself.
+		return Identifier, string(r)
+	case '\'', '"':
+		s.unread()
+		return s.scanString()
 	}
 
 	// keyword cases
@@ -91,10 +185,30 @@ func (s *Scanner) Scan() (t Token, lit string) {
 		return Operator, sr
 	case "min":
 		return Operator, sr
+	case "shape", "dim", "iota":
+		return Operator, sr
+	case "real", "imag", "mag", "phase", "conj":
+		return Operator, sr
+	case "enclose", "disclose", "first", "depth":
+		return Operator, sr
+	case "and", "or", "not", "nand", "nor":
+		return Operator, sr
 	}
 	return Error, string(r)
 }
 
+// afterOperand determines if the last token scanned ends an operand, that is
+// an identifier, a string, a ')', a ']' or a number not followed by a space.
+func (s *Scanner) afterOperand() bool {
+	switch s.last {
+	case Identifier, String, RightParen, RightBracket:
+		return true
+	case Number:
+		return !s.spaced
+	}
+	return false
+}
+
 // scanWhitespace consumes the current rune and all contiguous whitespace.
 func (s *Scanner) scanWhitespace() (t Token, lit string) {
 	// Create a buffer and read the current character into it.
@@ -137,27 +251,114 @@ func (s *Scanner) scanIdentifier() (t Token, lit string) {
 	return Identifier, buf.String()
 }
 
-// scanNumber consumes the current rune and all contiguous digit runes.
+// scanString consumes a quoted string, the quote is either ' or ".
+// A quote is written inside a string by doubling it: "say ""hi"""
+// The literal keeps its quotes, an unterminated string is an error.
+func (s *Scanner) scanString() (tok Token, lit string) {
+	var buf bytes.Buffer
+	quote := s.read()
+	buf.WriteRune(quote)
+	for {
+		r := s.read()
+		if r == eof || r == '\n' {
+			if r != eof {
+				s.unread()
+			}
+			return Error, buf.String()
+		}
+		buf.WriteRune(r)
+		if r == quote {
+			if s.peek() != quote {
+				return String, buf.String()
+			}
+			buf.WriteRune(s.read())
+		}
+	}
+}
+
+// scanDigit consumes the current rune and all contiguous number runes.
+// A number is made of digits with an optional decimal part and an optional
+// exponent: 1 1.5 .5 1e-3 1E6
+// A complex number is made of two numbers separated by a 'j': 3j4 1.5j-2
 func (s *Scanner) scanDigit() (tok Token, lit string) {
-	// Create a buffer and rtead the current character into it.
+	// Create a buffer and read the current character into it.
 	var buf bytes.Buffer
-	buf.WriteRune(s.read())
+	r := s.read()
+	buf.WriteRune(r)
 
-	// Read every subsequent digit into the buffer.
-	// Non digit characters and EOF will cause the loop to exit.
+	// Read every subsequent digit, decimal point, exponent and imaginary part
+	// into the buffer.
+	// Other characters and EOF will cause the loop to exit.
+	dot, exp, imag := r == '.', false, false
 	for {
-		if r := s.read(); r == eof {
-			break
-		} else if !isDigit(r) {
-			s.unread()
-			break
+		if r := s.peek(); isDigit(r) {
+			_, _ = buf.WriteRune(s.read())
+		} else if r == '.' && !dot && !exp {
+			dot = true
+			_, _ = buf.WriteRune(s.read())
+		} else if (r == 'e' || r == 'E') && !exp && s.isExponentAhead() {
+			exp = true
+			_, _ = buf.WriteRune(s.read())
+			if r := s.peek(); r == '-' || r == '+' {
+				_, _ = buf.WriteRune(s.read())
+			}
+		} else if (r == 'j' || r == 'J') && !imag && s.isImaginaryAhead() {
+			dot, exp, imag = false, false, true
+			_, _ = buf.WriteRune(s.read())
+			if r := s.peek(); r == '-' {
+				_, _ = buf.WriteRune(s.read())
+			}
+			if r := s.peek(); r == '.' {
+				dot = true
+				_, _ = buf.WriteRune(s.read())
+			}
 		} else {
-			_, _ = buf.WriteRune(r)
+			break
 		}
 	}
 	return Number, buf.String()
 }
 
+// startsNumber determines if the bytes passed as param start a number: 1 or .5
+func startsNumber(b []byte) bool {
+	if len(b) > 0 && b[0] == '.' {
+		b = b[1:]
+	}
+	return len(b) > 0 && isDigit(rune(b[0]))
+}
+
+// isNumberAhead determines if the next runes start a number: 1 or .5
+func (s *Scanner) isNumberAhead() bool {
+	b, _ := s.r.Peek(2)
+	return startsNumber(b)
+}
+
+// isExponentAhead determines if the next runes are an exponent marker
+// followed by digits with an optional sign: e3 e-3 E+3
+func (s *Scanner) isExponentAhead() bool {
+	b, _ := s.r.Peek(3)
+	if len(b) > 0 {
+		b = b[1:]
+	}
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		b = b[1:]
+	}
+	return len(b) > 0 && isDigit(rune(b[0]))
+}
+
+// isImaginaryAhead determines if the next runes are an imaginary marker
+// followed by a number with an optional sign: j4 j-4 J.5
+func (s *Scanner) isImaginaryAhead() bool {
+	b, _ := s.r.Peek(4)
+	if len(b) > 0 {
+		b = b[1:]
+	}
+	if len(b) > 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	return startsNumber(b)
+}
+
 // eof rune to treat EOF like any other character
 var eof = rune(0)
 
@@ -180,9 +381,36 @@ func isDigit(r rune) bool {
 }
 
 func isKeyword(s string) bool {
-	return (s == "max") || (s == "min")
+	return (s == "max") || (s == "min") || (s == "shape") || (s == "dim") || (s == "iota") || isComplexFunction(s) || isNestedFunction(s) || isLogicalFunction(s)
 }
 
+// isUnary determines if the operator passed as param can be used monadically.
 func isUnary(s string) bool {
-	return (s == "+\\") || (s == "+/") || (s == "*\\") || (s == "*/")
+	return (s == "dim") || (s == "iota") || isComplexFunction(s) || isNestedFunction(s) || (s == "not")
+}
+
+// isBinary determines if the operator passed as param can be used dyadically.
+func isBinary(s string) bool {
+	return (s == "+") || (s == "-") || (s == "/") || (s == "*") || (s == "**") ||
+		(s == "max") || (s == "min") || (s == "shape") || (s == "iota") ||
+		(s == "==") || (s == "!=") || (s == "<") || (s == "<=") || (s == ">") || (s == ">=") ||
+		((s != "not") && isLogicalFunction(s))
+}
+
+// isComplexFunction determines if the string passed as param is one of the
+// monadic functions on complex numbers.
+func isComplexFunction(s string) bool {
+	return (s == "real") || (s == "imag") || (s == "mag") || (s == "phase") || (s == "conj")
+}
+
+// isNestedFunction determines if the string passed as param is one of the
+// monadic functions on nested arrays.
+func isNestedFunction(s string) bool {
+	return (s == "enclose") || (s == "disclose") || (s == "first") || (s == "depth")
+}
+
+// isLogicalFunction determines if the string passed as param is one of the
+// logical functions.
+func isLogicalFunction(s string) bool {
+	return (s == "and") || (s == "or") || (s == "not") || (s == "nand") || (s == "nor")
 }
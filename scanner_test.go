@@ -18,23 +18,79 @@ func TestScanner_Scan(t *testing.T) {
 		{s: "\n", tok: Space, lit: "\n"},
 		{s: `*`, tok: Operator, lit: `*`},
 		{s: `-`, tok: Operator, lit: `-`},
+		{s: `-1`, tok: Number, lit: `-1`},
+		{s: `- 1`, tok: Operator, lit: `-`},
+		{s: `1.5`, tok: Number, lit: `1.5`},
+		{s: `.5`, tok: Number, lit: `.5`},
+		{s: `-.5`, tok: Number, lit: `-.5`},
+		{s: `¯1`, tok: Number, lit: `-1`},
+		{s: `¯.5`, tok: Number, lit: `-.5`},
+		{s: `.`, tok: Dot, lit: `.`},
 		{s: `+`, tok: Operator, lit: `+`},
 		{s: `/`, tok: Operator, lit: `/`},
 		{s: `**`, tok: Operator, lit: `**`},
 		{s: `max`, tok: Operator, lit: `max`},
 		{s: `min`, tok: Operator, lit: `min`},
-		{s: `+\`, tok: Operator, lit: `+\`},
-		{s: `+/`, tok: Operator, lit: `+/`},
-		{s: `*/`, tok: Operator, lit: `*/`},
-		{s: `*\`, tok: Operator, lit: `*\`},
+		{s: `shape`, tok: Operator, lit: `shape`},
+		{s: `dim`, tok: Operator, lit: `dim`},
+		{s: `iota`, tok: Operator, lit: `iota`},
+		{s: `real`, tok: Operator, lit: `real`},
+		{s: `imag`, tok: Operator, lit: `imag`},
+		{s: `mag`, tok: Operator, lit: `mag`},
+		{s: `phase`, tok: Operator, lit: `phase`},
+		{s: `conj`, tok: Operator, lit: `conj`},
+		{s: `\`, tok: Operator, lit: `\`},
+		{s: `+\`, tok: Operator, lit: `+`},
+		{s: `+/`, tok: Operator, lit: `+`},
+		{s: `*/`, tok: Operator, lit: `*`},
+		{s: `**/`, tok: Operator, lit: `**`},
 		{s: `=`, tok: Assign, lit: `=`},
+		{s: `==`, tok: Operator, lit: `==`},
+		{s: `!=`, tok: Operator, lit: `!=`},
+		{s: `!`, tok: Error, lit: `!`},
+		{s: `<`, tok: Operator, lit: `<`},
+		{s: `<=`, tok: Operator, lit: `<=`},
+		{s: `>`, tok: Operator, lit: `>`},
+		{s: `>=`, tok: Operator, lit: `>=`},
+		{s: `≠`, tok: Operator, lit: `!=`},
+		{s: `≤`, tok: Operator, lit: `<=`},
+		{s: `≥`, tok: Operator, lit: `>=`},
+		{s: `and`, tok: Operator, lit: `and`},
+		{s: `or`, tok: Operator, lit: `or`},
+		{s: `not`, tok: Operator, lit: `not`},
+		{s: `nand`, tok: Operator, lit: `nand`},
+		{s: `nor`, tok: Operator, lit: `nor`},
+		{s: `order`, tok: Identifier, lit: `order`},
+		{s: `(`, tok: LeftParen, lit: `(`},
+		{s: `)`, tok: RightParen, lit: `)`},
+		{s: `[`, tok: LeftBracket, lit: `[`},
+		{s: `]`, tok: RightBracket, lit: `]`},
+		{s: `:`, tok: Colon, lit: `:`},
+		{s: `;`, tok: Semicolon, lit: `;`},
+		{s: `∘`, tok: Jot, lit: `∘`},
+		{s: `∘.==`, tok: Jot, lit: `∘`},
+		{s: `.==`, tok: Dot, lit: `.`},
+		{s: `¨`, tok: Diaeresis, lit: `¨`},
+		{s: `{`, tok: LeftBrace, lit: `{`},
+		{s: `}`, tok: RightBrace, lit: `}`},
+		{s: `⋄`, tok: Diamond, lit: `⋄`},
+		{s: `⍺`, tok: Identifier, lit: `⍺`},
+		{s: `⍵[1]`, tok: Identifier, lit: `⍵`},
+		{s: `∇ ⍵`, tok: Identifier, lit: `∇`},
+		{s: `'abc'`, tok: String, lit: `'abc'`},
+		{s: `"abc"`, tok: String, lit: `"abc"`},
+		{s: `''`, tok: String, lit: `''`},
+		{s: `'it''s' 1`, tok: String, lit: `'it''s'`},
+		{s: `"a'b"`, tok: String, lit: `"a'b"`},
+		{s: `'abc`, tok: Error, lit: `'abc`},
+		{s: "'ab\nc'", tok: Error, lit: `'ab`},
 		{s: `a`, tok: Identifier, lit: `a`},
 		{s: `a42`, tok: Identifier, lit: `a42`},
 		{s: `a_42`, tok: Identifier, lit: `a_42`},
 	}
 	for i, tt := range tests {
 		s := NewScanner(strings.NewReader(tt.s))
-		tok, lit := s.Scan()
+		tok, lit, _ := s.Scan()
 		if tt.tok != tok {
 			t.Errorf("%d. %q token mismatch: exp=%q got=%q <%q>", i, tt.s, tt.tok, tok, lit)
 		} else if tt.lit != lit {
@@ -43,6 +99,28 @@ func TestScanner_Scan(t *testing.T) {
 	}
 }
 
+func TestScanner_ScanPositions(t *testing.T) {
+	var tests = []struct {
+		s   string
+		pos []Pos
+	}{
+		{s: ``, pos: []Pos{{0, 1, 1}}},
+		{s: `1 + 2`, pos: []Pos{{0, 1, 1}, {1, 1, 2}, {2, 1, 3}, {3, 1, 4}, {4, 1, 5}, {5, 1, 6}}},
+		{s: `12+a`, pos: []Pos{{0, 1, 1}, {2, 1, 3}, {3, 1, 4}, {4, 1, 5}}},
+		{s: "1\n 2", pos: []Pos{{0, 1, 1}, {1, 1, 2}, {3, 2, 2}, {4, 2, 3}}},
+		{s: "+/ max", pos: []Pos{{0, 1, 1}, {1, 1, 2}, {2, 1, 3}, {3, 1, 4}, {6, 1, 7}}},
+		{s: "é 1", pos: []Pos{{0, 1, 1}, {2, 1, 2}, {3, 1, 3}, {4, 1, 4}}},
+	}
+	for i, tt := range tests {
+		s := NewScanner(strings.NewReader(tt.s))
+		for j, exp := range tt.pos {
+			if _, lit, pos := s.Scan(); pos != exp {
+				t.Errorf("%d. %q token %d %q position mismatch: exp=%v got=%v", i, tt.s, j, lit, exp, pos)
+			}
+		}
+	}
+}
+
 func TestScanner_scanwhitespace(t *testing.T) {
 	var tests = []struct {
 		s   string
@@ -132,6 +210,22 @@ func TestScanner_scanDigit(t *testing.T) {
 		{s: "111", tok: Number, lit: "111"},
 		{s: "123456789", tok: Number, lit: "123456789"},
 		{s: " 123456789", tok: Number, lit: " 123456789"},
+		{s: "1.5", tok: Number, lit: "1.5"},
+		{s: ".5", tok: Number, lit: ".5"},
+		{s: "1.5.5", tok: Number, lit: "1.5"},
+		{s: "1e3", tok: Number, lit: "1e3"},
+		{s: "1e-3", tok: Number, lit: "1e-3"},
+		{s: "1E+6", tok: Number, lit: "1E+6"},
+		{s: "1.5e3", tok: Number, lit: "1.5e3"},
+		{s: "1e", tok: Number, lit: "1"},
+		{s: "1e-", tok: Number, lit: "1"},
+		{s: "1emax", tok: Number, lit: "1"},
+		{s: "3j4", tok: Number, lit: "3j4"},
+		{s: "3J-4", tok: Number, lit: "3J-4"},
+		{s: "1.5j.5", tok: Number, lit: "1.5j.5"},
+		{s: "1e2j1e-2", tok: Number, lit: "1e2j1e-2"},
+		{s: "3j4j5", tok: Number, lit: "3j4"},
+		{s: "3j", tok: Number, lit: "3"},
 	}
 
 	for i, tt := range tests {
@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 // Token represents a lexical token
 type Token int
 
@@ -16,6 +18,83 @@ const (
 	Operator
 	// Space represents space separation between tokens
 	Space
-	// Identifier represent an identifier such as a var name
+	// Identifier represent an identifier such as a var name or '⍺' '⍵' '∇'
 	Identifier
+	// LeftParen represents the opening of a group '('
+	LeftParen
+	// RightParen represents the closing of a group ')'
+	RightParen
+	// LeftBracket represents the opening of an index '['
+	LeftBracket
+	// RightBracket represents the closing of an index ']'
+	RightBracket
+	// Colon represents the separation of the bounds of a slice ':'
+	Colon
+	// Semicolon represents the separation of the axes of an index ';'
+	Semicolon
+	// String represents a quoted string such as 'abc' or "abc"
+	String
+	// Jot represents the jot of the outer product '∘'
+	Jot
+	// Dot represents the dot of a product '.'
+	Dot
+	// Diaeresis represents the each operator '¨'
+	Diaeresis
+	// LeftBrace represents the opening of a function '{'
+	LeftBrace
+	// RightBrace represents the closing of a function '}'
+	RightBrace
+	// Diamond represents the separation of the statements of a function '⋄'
+	Diamond
 )
+
+var tokens = [...]string{
+	EOF:          "EOF",
+	Error:        "Error",
+	Assign:       "Assign",
+	Number:       "Number",
+	Operator:     "Operator",
+	Space:        "Space",
+	Identifier:   "Identifier",
+	LeftParen:    "LeftParen",
+	RightParen:   "RightParen",
+	LeftBracket:  "LeftBracket",
+	RightBracket: "RightBracket",
+	Colon:        "Colon",
+	Semicolon:    "Semicolon",
+	String:       "String",
+	Jot:          "Jot",
+	Dot:          "Dot",
+	Diaeresis:    "Diaeresis",
+	LeftBrace:    "LeftBrace",
+	RightBrace:   "RightBrace",
+	Diamond:      "Diamond",
+}
+
+// String returns the string representation of a token.
+func (t Token) String() string {
+	if t >= 0 && int(t) < len(tokens) {
+		return tokens[t]
+	}
+	return fmt.Sprintf("Token(%d)", int(t))
+}
+
+// Pos represents the position of a token in the input.
+type Pos struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in runes, starting at 1
+}
+
+// NoPos represents the absence of position.
+var NoPos = Pos{}
+
+// IsValid determines if the position is known.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the string representation of a position: line:column
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
@@ -1,20 +1,23 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 // Expression is an interface to wrap objects from the parser.
 type Expression interface {
 	String() string
-	Evaluate() Value
+	Evaluate() (Value, error)
 }
 
 // Value is an interface to handle different types.
 type Value interface {
 	String() string
-	Evaluate() Value
+	Evaluate() (Value, error)
 }
 
 // Int is a type to handle integers
@@ -26,8 +29,8 @@ func (i Int) String() string {
 }
 
 // Evaluate returns the value of the given integer.
-func (i Int) Evaluate() Value {
-	return i
+func (i Int) Evaluate() (Value, error) {
+	return i, nil
 }
 
 func tryIntString(s string) (Value, error) {
@@ -35,27 +38,411 @@ func tryIntString(s string) (Value, error) {
 	return Int(i), err
 }
 
+// BigInt is a type to handle integers that do not fit in an Int.
+type BigInt struct {
+	x *big.Int
+}
+
+// String returns the string representation of a big integer.
+func (b BigInt) String() string {
+	return b.x.String()
+}
+
+// Evaluate returns the value of the given big integer.
+func (b BigInt) Evaluate() (Value, error) {
+	return b, nil
+}
+
+// bigIntValue returns x as an Int if it fits in one, as a BigInt otherwise.
+func bigIntValue(x *big.Int) Value {
+	if x.IsInt64() {
+		return Int(x.Int64())
+	}
+	return BigInt{x}
+}
+
+func tryBigIntString(s string) (Value, error) {
+	x, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an integer", s)
+	}
+	return bigIntValue(x), nil
+}
+
+// Rational is a type to handle exact fractions such as 1/3.
+type Rational struct {
+	x *big.Rat
+}
+
+// String returns the string representation of a rational.
+func (r Rational) String() string {
+	return r.x.RatString()
+}
+
+// Evaluate returns the value of the given rational.
+func (r Rational) Evaluate() (Value, error) {
+	return r, nil
+}
+
+// ratValue returns x as an integer if its denominator is 1, as a Rational
+// otherwise.
+func ratValue(x *big.Rat) Value {
+	if x.IsInt() {
+		return bigIntValue(new(big.Int).Set(x.Num()))
+	}
+	return Rational{x}
+}
+
+// Float is a type to handle floating point numbers
+type Float float64
+
+// String returns the string representation of a float.
+func (f Float) String() string {
+	return strconv.FormatFloat(float64(f), 'g', 10, 64)
+}
+
+// Evaluate returns the value of the given float.
+func (f Float) Evaluate() (Value, error) {
+	return f, nil
+}
+
+func tryFloatString(s string) (Value, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	return Float(f), err
+}
+
+// Complex is a type to handle complex numbers
+type Complex complex128
+
+// String returns the string representation of a complex number: 3j4
+func (c Complex) String() string {
+	return fmt.Sprintf("%vj%v", Float(real(c)), Float(imag(c)))
+}
+
+// Evaluate returns the value of the given complex number.
+func (c Complex) Evaluate() (Value, error) {
+	return c, nil
+}
+
+// complexValue returns c as a Float if its imaginary part is 0, as a
+// Complex otherwise.
+func complexValue(c complex128) Value {
+	if imag(c) == 0 {
+		return Float(real(c))
+	}
+	return Complex(c)
+}
+
+func tryComplexString(s string) (Value, error) {
+	i := strings.IndexAny(s, "jJ")
+	if i < 0 {
+		return nil, fmt.Errorf("%v is not a complex number", s)
+	}
+	re, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return nil, err
+	}
+	im, err := strconv.ParseFloat(s[i+1:], 64)
+	if err != nil {
+		return nil, err
+	}
+	return complexValue(complex(re, im)), nil
+}
+
+// Char is a type to handle characters.
+type Char rune
+
+// String returns the string representation of a character.
+func (c Char) String() string {
+	return string(c)
+}
+
+// Evaluate returns the value of the given character.
+func (c Char) Evaluate() (Value, error) {
+	return c, nil
+}
+
+// EmptyChars is a type to handle an empty array of characters, it is
+// padded with spaces where an empty array of numbers is padded with zeros.
+// example 0 shape 'abc'
+type EmptyChars struct {
+	shape []int
+}
+
+// String returns the string representation of an empty array of characters.
+func (e EmptyChars) String() string {
+	return ""
+}
+
+// Evaluate returns the value of a given empty array of characters.
+func (e EmptyChars) Evaluate() (Value, error) {
+	return e, nil
+}
+
+// stringValue returns the characters of the quoted string literal lit, a
+// character if there is only one and a character vector otherwise.
+// example "say ""hi"""
+func stringValue(lit string) Value {
+	quote := lit[:1]
+	s := strings.Replace(lit[1:len(lit)-1], quote+quote, quote, -1)
+	v := Vector{}
+	for _, r := range s {
+		v = append(v, Char(r))
+	}
+	switch len(v) {
+	case 0:
+		return EmptyChars{shape: []int{0}}
+	case 1:
+		return v[0]
+	}
+	return v
+}
+
+// isChars determines if all the items of v are characters.
+func isChars(v Vector) bool {
+	for i := range v {
+		if _, ok := v[i].(Char); !ok {
+			return false
+		}
+	}
+	return len(v) > 0
+}
+
 // Vector is a type to handle vectors
 type Vector []Value
 
-// String returns the string representation of a vector
+// String returns the string representation of a vector, its items
+// separated by spaces unless they are all characters.
 func (v Vector) String() string {
-	ret := ""
+	items := make([]string, len(v))
 	for i := range v {
-		ret += fmt.Sprintf("%v ", v[i])
+		items[i] = v[i].String()
 	}
-	ret += fmt.Sprintf("\n")
-	return ret
+	if isChars(v) {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items, " ")
+}
+
+// Evaluate returns the value of a given vector, packed if its items are all
+// integers or all floats.
+func (v Vector) Evaluate() (Value, error) {
+	return newArray([]int{len(v)}, v), nil
+}
+
+// Array is a type to handle arrays of rank 2 or more, such as matrices.
+// The items are stored in row-major order.
+type Array struct {
+	shape []int
+	data  Vector
+}
+
+// String returns the string representation of an array.
+// The items of each column are aligned to the right and the matrices of an
+// array of rank 3 or more are separated by an empty line. The items of a
+// character array are not separated by spaces.
+func (a Array) String() string {
+	cols := a.shape[len(a.shape)-1]
+	items := make([]string, len(a.data))
+	widths := make([]int, cols)
+	for i := range a.data {
+		items[i] = a.data[i].String()
+		if n := len([]rune(items[i])); n > widths[i%cols] {
+			widths[i%cols] = n
+		}
+	}
+
+	sep := " "
+	if isChars(a.data) {
+		sep = ""
+	}
+	rows := a.shape[len(a.shape)-2]
+	var lines []string
+	for r := 0; r*cols < len(items); r++ {
+		if r > 0 && r%rows == 0 {
+			lines = append(lines, "")
+		}
+		line := ""
+		for c := 0; c < cols; c++ {
+			if c > 0 {
+				line += sep
+			}
+			line += fmt.Sprintf("%*s", widths[c], items[r*cols+c])
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Evaluate returns the value of a given array, packed if its items are all
+// integers or all floats.
+func (a Array) Evaluate() (Value, error) {
+	return newArray(a.shape, a.data), nil
 }
 
-// Evaluate returns the value of a given vector.
-func (v Vector) Evaluate() Value {
+// Box is a type to handle an enclosed array, that is a scalar holding an
+// array. It is how a vector or an array holds an item that is an array.
+type Box struct {
+	v Value
+}
+
+// String returns the string representation of an enclosed array, the array
+// is shown in parentheses.
+// example 1 (2 3) (2 2 shape 1)
+// 1 (2 3) (2 2 shape 1 1 1 1)
+func (b Box) String() string {
+	if len(shapeOf(b.v)) > 1 {
+		shape, _ := dim(b.v)
+		return fmt.Sprintf("(%v shape %v)", shape, ravel(b.v))
+	}
+	return fmt.Sprintf("(%v)", b.v)
+}
+
+// Evaluate returns the value of a given enclosed array.
+func (b Box) Evaluate() (Value, error) {
+	return b, nil
+}
+
+// box returns v enclosed if it is an array so it can be an item of an array.
+func box(v Value) Value {
+	if len(shapeOf(v)) > 0 {
+		return Box{v}
+	}
 	return v
 }
 
+// open returns the array enclosed in v if v is enclosed, v otherwise.
+func open(v Value) Value {
+	if b, ok := v.(Box); ok {
+		return b.v
+	}
+	return v
+}
+
+// emptyLike returns an empty array of the given shape that is padded like
+// the array 'a'.
+func emptyLike(shape []int, a Value) Value {
+	if fill(a) == Char(' ') {
+		return EmptyChars{shape: shape}
+	}
+	return newArray(shape, Vector{})
+}
+
+// newArray returns the items in data with the given shape.
+// The value is a scalar when the shape is empty, a packed array when the
+// items are all integers or all floats, a vector when the shape has one
+// dimension and an array otherwise.
+func newArray(shape []int, data Vector) Value {
+	if len(shape) == 0 {
+		return data[0]
+	}
+	if v, ok := pack(shape, data); ok {
+		return v
+	}
+	if len(shape) == 1 {
+		return data
+	}
+	return Array{shape: shape, data: data}
+}
+
+// shapeOf returns the shape of the value v, it is empty for a scalar.
+func shapeOf(v Value) []int {
+	switch v := v.(type) {
+	case Vector:
+		return []int{len(v)}
+	case Array:
+		return v.shape
+	case Ints:
+		return v.shape
+	case Floats:
+		return v.shape
+	case Bools:
+		return v.shape
+	case EmptyChars:
+		return v.shape
+	}
+	return nil
+}
+
+// ravel returns the items of the value v in row-major order.
+func ravel(v Value) Vector {
+	switch v := v.(type) {
+	case Vector:
+		return v
+	case Array:
+		return v.data
+	case Ints:
+		data := make(Vector, len(v.data))
+		for i, x := range v.data {
+			data[i] = Int(x)
+		}
+		return data
+	case Floats:
+		data := make(Vector, len(v.data))
+		for i, x := range v.data {
+			data[i] = Float(x)
+		}
+		return data
+	case Bools:
+		data := make(Vector, len(v.data))
+		for i, x := range v.data {
+			data[i] = boolValue(x)
+		}
+		return data
+	}
+	if _, ok := v.(EmptyChars); ok {
+		return Vector{}
+	}
+	return Vector{v}
+}
+
+// Strand represents a vector written as adjacent items where some of the
+// items are expressions.
+// example 1 (2 + 3) 4
+type Strand []Expression
+
+// String returns the string representation of a strand.
+func (s Strand) String() string {
+	ret := ""
+	for i := range s {
+		if i > 0 {
+			ret += " "
+		}
+		switch s[i].(type) {
+		case Unary, Binary:
+			ret += fmt.Sprintf("(%v)", s[i])
+		default:
+			ret += fmt.Sprintf("%v", s[i])
+		}
+	}
+	return ret
+}
+
+// Evaluate returns the vector of the values of the items of the strand.
+// Items are evaluated from right to left, an item that is an array is
+// enclosed.
+func (s Strand) Evaluate() (Value, error) {
+	v := make(Vector, len(s))
+	for i := len(s) - 1; i >= 0; i-- {
+		val, err := s[i].Evaluate()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := val.(Dfn); ok {
+			return nil, newError(SyntaxError, "", "%v is a function, not an item of an array", s[i])
+		}
+		v[i] = box(val)
+	}
+	return newArray([]int{len(v)}, v), nil
+}
+
 // Variable represents a variable.
+// Its scope is the one of the call of a user-defined function it is part
+// of, nil for a global variable.
 type Variable struct {
-	name string
+	name  string
+	scope *scope
+	pos   Pos
 }
 
 // String returns the string representation of a variable.
@@ -64,20 +451,195 @@ func (v Variable) String() string {
 }
 
 // Evaluate returns the value holded by the variable v
-func (v Variable) Evaluate() Value {
-	if val, ok := stack[v.name]; ok {
-		return val
+func (v Variable) Evaluate() (Value, error) {
+	val, ok := v.scope.lookup(v.name)
+	if !ok {
+		return nil, atPos(newError(ValueError, "", "%v is undefined", v.name), v.pos)
 	}
-	return nil
+	if d, ok := val.(Dfn); ok {
+		// a function is called from the scope it is read in.
+		d.caller = v.scope
+		return d, nil
+	}
+	return val, nil
 }
 
-// Unary represents an unary statement
-// example +/ 1 2 3
-// example +\ 1 2 3
-// todo(santiaago): should add +2 -4 a unary objects
+// Assignment represents the assignment of the value of an expression to a
+// variable.
+// Inside a user-defined function the variable is local to the call.
+// example a = 1 2 3
+type Assignment struct {
+	name  string
+	Val   Expression
+	scope *scope
+	pos   Pos
+}
+
+// String returns the string representation of an assignment.
+func (x Assignment) String() string {
+	return fmt.Sprintf("%v = %v", x.name, x.Val)
+}
+
+// Evaluate stores the value of the expression in the variable and returns
+// that value.
+func (x Assignment) Evaluate() (Value, error) {
+	val, err := x.Val.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	if x.name == originName && x.scope != nil {
+		// the index origin is global, a local one would have no effect.
+		return nil, atPos(newError(SyntaxError, "", "%v can not be assigned in a function", originName), x.pos)
+	}
+	if x.name == originName && val != Int(0) && val != Int(1) {
+		return nil, atPos(newError(DomainError, "", "%v must be 0 or 1", originName), x.pos)
+	}
+	x.scope.set(x.name, val)
+	return val, nil
+}
+
+// Index represents the indexing of an expression with one subscript per
+// axis.
+// example y[2]
+// example y[-2:]
+// example m[1;2]
+type Index struct {
+	Val  Expression
+	Subs []Subscript
+	pos  Pos
+}
+
+// Subscript represents the subscript of one axis of an index.
+// It is either the expression Expr or a slice From:To where both bounds are
+// optional. A slice without bounds selects the whole axis.
+type Subscript struct {
+	Expr     Expression
+	Slice    bool
+	From, To Expression
+}
+
+// String returns the string representation of a subscript.
+func (s Subscript) String() string {
+	if !s.Slice {
+		return s.Expr.String()
+	}
+	ret := ""
+	if s.From != nil {
+		ret += s.From.String()
+	}
+	if s.From != nil || s.To != nil {
+		ret += ":"
+	}
+	if s.To != nil {
+		ret += s.To.String()
+	}
+	return ret
+}
+
+// String returns the string representation of an index.
+func (x Index) String() string {
+	subs := make([]string, len(x.Subs))
+	for i := range x.Subs {
+		subs[i] = x.Subs[i].String()
+	}
+	return fmt.Sprintf("%v[%v]", x.Val, strings.Join(subs, ";"))
+}
+
+// Evaluate returns the items of the value of the indexed expression selected
+// by the subscripts.
+// As in APL the subscripts are evaluated from right to left and before the
+// indexed expression.
+func (x Index) Evaluate() (Value, error) {
+	axes, err := x.axes()
+	if err != nil {
+		return nil, err
+	}
+	val, err := x.Val.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	val, err = index(val, axes)
+	return val, atPos(err, x.pos)
+}
+
+// axes evaluates the subscripts of the index from right to left.
+func (x Index) axes() ([]axis, error) {
+	axes := make([]axis, len(x.Subs))
+	for i := len(x.Subs) - 1; i >= 0; i-- {
+		sub := x.Subs[i]
+		axes[i].slice = sub.Slice
+		var err error
+		if axes[i].to, err = evaluate(sub.To); err != nil {
+			return nil, err
+		}
+		if axes[i].from, err = evaluate(sub.From); err != nil {
+			return nil, err
+		}
+		if axes[i].idx, err = evaluate(sub.Expr); err != nil {
+			return nil, err
+		}
+	}
+	return axes, nil
+}
+
+// IndexAssign represents the assignment of the value of an expression to
+// the items of a variable selected by an index.
+// example y[2] = 10
+// example m[1;] = 0
+type IndexAssign struct {
+	Index Index
+	Val   Expression
+	pos   Pos
+}
+
+// String returns the string representation of an indexed assignment.
+func (x IndexAssign) String() string {
+	return fmt.Sprintf("%v = %v", x.Index, x.Val)
+}
+
+// Evaluate replaces the selected items of the variable by the value of the
+// expression and returns that value.
+// The variable gets a new array so other variables holding the same array
+// are not modified.
+func (x IndexAssign) Evaluate() (Value, error) {
+	val, err := x.Val.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	axes, err := x.Index.axes()
+	if err != nil {
+		return nil, err
+	}
+	v := x.Index.Val.(Variable)
+	a, err := v.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	r, err := assign(a, axes, val)
+	if err != nil {
+		return nil, atPos(err, x.pos)
+	}
+	v.scope.set(v.name, r)
+	return val, nil
+}
+
+// evaluate returns the value of the expression, nil if there is no
+// expression.
+func evaluate(expr Expression) (Value, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	return expr.Evaluate()
+}
+
+// Unary represents the application of a monadic operator to the
+// expression on its right.
+// example dim 1 2 3
+// example iota 5
 type Unary struct {
-	Val      Value
+	Val      Expression
 	Operator string
+	pos      Pos
 }
 
 // String returns the string representation of a unary type
@@ -87,25 +649,59 @@ func (u Unary) String() string {
 
 // Evaluate returns the return of the operator computed with the value of the
 // unary type
-func (u Unary) Evaluate() Value {
-	if u.Operator == "+/" {
-		return sum(u.Val)
-	} else if u.Operator == "+\\" {
-		return scanSum(u.Val)
-	} else if u.Operator == "*/" {
-		return multiply(u.Val)
-	} else if u.Operator == "*\\" {
-		return scanMultiply(u.Val)
+func (u Unary) Evaluate() (Value, error) {
+	val, err := u.Val.Evaluate()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	fn := unary(u.Operator)
+	if fn == nil {
+		return nil, atPos(newError(SyntaxError, u.Operator, "not a monadic function"), u.pos)
+	}
+	val, err = fn(val)
+	return val, atPos(err, u.pos)
+}
+
+// unary returns the monadic function of the given name, nil if there is
+// none.
+func unary(name string) func(Value) (Value, error) {
+	var fn func(Value) (Value, error)
+	if name == "real" {
+		fn = realPart
+	} else if name == "imag" {
+		fn = imagPart
+	} else if name == "mag" {
+		fn = magnitude
+	} else if name == "phase" {
+		fn = phase
+	} else if name == "conj" {
+		fn = conjugate
+	} else if name == "dim" {
+		fn = dim
+	} else if name == "iota" {
+		fn = interval
+	} else if name == "enclose" {
+		fn = enclose
+	} else if name == "disclose" {
+		fn = disclose
+	} else if name == "first" {
+		fn = first
+	} else if name == "depth" {
+		fn = depth
+	} else if name == "not" {
+		fn = not
+	}
+	return fn
 }
 
-// Binary represents a binary statement
+// Binary represents the application of a dyadic operator to the
+// expressions on its left and right.
 // example: 12 + 3
 type Binary struct {
-	Left     Value
-	Right    Value
+	Left     Expression
+	Right    Expression
 	Operator string
+	pos      Pos
 }
 
 // String returns the string of the number
@@ -113,33 +709,278 @@ func (b Binary) String() string {
 	return fmt.Sprintf("%v %v %v", b.Left, b.Operator, b.Right)
 }
 
-// Evaluate returns the number value
-func (b Binary) Evaluate() Value {
-	if b.Operator == "+" {
-		return add(b.Left, b.Right)
-	} else if b.Operator == "-" {
-		return minus(b.Left, b.Right)
-	} else if b.Operator == "/" {
-		return divide(b.Left, b.Right)
-	} else if b.Operator == "*" {
-		return times(b.Left, b.Right)
-	} else if b.Operator == "**" {
-		return pow(b.Left, b.Right)
-	} else if b.Operator == "max" {
-		return max(b.Left, b.Right)
-	} else if b.Operator == "min" {
-		return min(b.Left, b.Right)
+// Evaluate returns the value of the operator computed with the values of
+// the left and right expressions.
+// As in APL the right expression is evaluated first.
+func (b Binary) Evaluate() (Value, error) {
+	right, err := b.Right.Evaluate()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	left, err := b.Left.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	fn := dyadic(b.Operator)
+	if fn == nil {
+		return nil, atPos(newError(SyntaxError, b.Operator, "not a dyadic function"), b.pos)
+	}
+	val, err := fn(left, right)
+	return val, atPos(err, b.pos)
+}
+
+// dyadic returns the dyadic function of the given name, nil if there is
+// none.
+func dyadic(name string) func(Value, Value) (Value, error) {
+	var fn func(Value, Value) (Value, error)
+	if name == "+" {
+		fn = add
+	} else if name == "-" {
+		fn = minus
+	} else if name == "/" {
+		fn = divide
+	} else if name == "*" {
+		fn = times
+	} else if name == "**" {
+		fn = pow
+	} else if name == "max" {
+		fn = max
+	} else if name == "min" {
+		fn = min
+	} else if name == "shape" {
+		fn = reshape
+	} else if name == "iota" {
+		fn = indexOf
+	} else if name == "==" {
+		fn = equal
+	} else if name == "!=" {
+		fn = notEqual
+	} else if name == "<" {
+		fn = less
+	} else if name == "<=" {
+		fn = lessEqual
+	} else if name == ">" {
+		fn = greater
+	} else if name == ">=" {
+		fn = greaterEqual
+	} else if name == "and" {
+		fn = and
+	} else if name == "or" {
+		fn = or
+	} else if name == "nand" {
+		fn = nand
+	} else if name == "nor" {
+		fn = nor
+	}
+	return fn
+}
+
+// Reduce represents the application of the function derived from a dyadic
+// function by the reduce operator '/' or the scan operator '\'.
+// The function applies along the last axis unless an axis is given.
+// example +/ 1 2 3
+// example max\ 3 1 4
+// example +/[1] 2 3 shape iota 6
+type Reduce struct {
+	Func Expression
+	Scan bool
+	Axis Expression
+	Val  Expression
+	pos  Pos
+}
+
+// String returns the string representation of a reduction.
+func (r Reduce) String() string {
+	op := "/"
+	if r.Scan {
+		op = "\\"
+	}
+	if r.Axis != nil {
+		op += fmt.Sprintf("[%v]", r.Axis)
+	}
+	return fmt.Sprintf("%v%v %v", r.Func, op, r.Val)
+}
+
+// Evaluate returns the reduction or the scan of the value of the expression
+// along the axis.
+func (r Reduce) Evaluate() (Value, error) {
+	val, err := r.Val.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	axis, err := evaluate(r.Axis)
+	if err != nil {
+		return nil, err
+	}
+	fname := r.Func.String()
+	name := fname + "/"
+	if r.Scan {
+		name = fname + "\\"
+	}
+	f, err := function(name, r.Func)
+	if err != nil {
+		return nil, atPos(err, r.pos)
+	}
+	k, err := axisOf(name, val, axis)
+	if err != nil {
+		return nil, atPos(err, r.pos)
+	}
+	fn := dyadicOf(f)
+	if r.Scan {
+		val, err = scan(name, fname, fn, val, k)
+	} else {
+		val, err = reduce(name, fname, fn, val, k)
+	}
+	return val, atPos(err, r.pos)
+}
+
+// Outer represents the outer product of the expressions on its left and
+// right by a dyadic function, the function applies between each item of the
+// left and each item of the right.
+// example (iota 3) ∘.* iota 3
+type Outer struct {
+	Left  Expression
+	Right Expression
+	Func  Expression
+	pos   Pos
+}
+
+// String returns the string representation of an outer product.
+func (o Outer) String() string {
+	return fmt.Sprintf("%v ∘.%v %v", o.Left, o.Func, o.Right)
+}
+
+// Evaluate returns the outer product of the values of the left and right
+// expressions.
+// As in APL the right expression is evaluated first.
+func (o Outer) Evaluate() (Value, error) {
+	right, err := o.Right.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	left, err := o.Left.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	name := "∘." + o.Func.String()
+	f, err := function(name, o.Func)
+	if err != nil {
+		return nil, atPos(err, o.pos)
+	}
+	val, err := outer(name, dyadicOf(f), left, right)
+	return val, atPos(err, o.pos)
+}
+
+// Inner represents the inner product of the expressions on its left and
+// right by two dyadic functions, the reduction by 'F' of 'G' applied between
+// the rows of the left and the columns of the right.
+// example (2 2 shape iota 4) +.* 2 2 shape iota 4
+type Inner struct {
+	Left  Expression
+	Right Expression
+	F     Expression
+	G     Expression
+	pos   Pos
+}
+
+// String returns the string representation of an inner product.
+func (p Inner) String() string {
+	return fmt.Sprintf("%v %v.%v %v", p.Left, p.F, p.G, p.Right)
+}
+
+// Evaluate returns the inner product of the values of the left and right
+// expressions.
+// As in APL the right expression is evaluated first.
+func (p Inner) Evaluate() (Value, error) {
+	right, err := p.Right.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	left, err := p.Left.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	fname, gname := p.F.String(), p.G.String()
+	name := fname + "." + gname
+	f, err := function(name, p.F)
+	if err != nil {
+		return nil, atPos(err, p.pos)
+	}
+	g, err := function(name, p.G)
+	if err != nil {
+		return nil, atPos(err, p.pos)
+	}
+	val, err := inner(name, fname, gname, dyadicOf(f), dyadicOf(g), left, right)
+	return val, atPos(err, p.pos)
+}
+
+// Each represents the application of the function derived from a function
+// by the each operator '¨', the function applies to each item of the right
+// expression, or between each pair of items of the left and right
+// expressions when there is a left one.
+// example dim¨ (1 2) (3 4 5)
+// example 1 2 shape¨ 3 4
+type Each struct {
+	Func  Expression
+	Left  Expression
+	Right Expression
+	pos   Pos
+}
+
+// String returns the string representation of an each.
+func (e Each) String() string {
+	if e.Left == nil {
+		return fmt.Sprintf("%v¨ %v", e.Func, e.Right)
+	}
+	return fmt.Sprintf("%v %v¨ %v", e.Left, e.Func, e.Right)
+}
+
+// Evaluate returns the function applied to each item of the value of the
+// right expression, paired with the items of the value of the left
+// expression if there is one.
+// As in APL the right expression is evaluated first.
+func (e Each) Evaluate() (Value, error) {
+	right, err := e.Right.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	left, err := evaluate(e.Left)
+	if err != nil {
+		return nil, err
+	}
+	name := e.Func.String() + "¨"
+	f, err := function(name, e.Func)
+	if err != nil {
+		return nil, atPos(err, e.pos)
+	}
+	if left == nil {
+		val, err := each(monadicOf(f), right)
+		return val, atPos(err, e.pos)
+	}
+	val, err := eachPair(name, dyadicOf(f), left, right)
+	return val, atPos(err, e.pos)
 }
 
 // ValueParse parse the string in the proper value
-// todo(santiaago): will have to try different types here...
-func ValueParse(s string) Value {
+// It tries an integer first, then a big integer, then a complex number and
+// then a float.
+func ValueParse(s string) (Value, error) {
 	v, err := tryIntString(s)
-	if err != nil {
-		fmt.Printf("ERROR failed to parse %v got error: %v\n", s, err)
-		return nil
+	if err == nil {
+		return v, nil
 	}
-	return v
+	if v, err = tryBigIntString(s); err == nil {
+		return v, nil
+	}
+	if v, err = tryComplexString(s); err == nil {
+		return v, nil
+	} else if errors.Is(err, strconv.ErrRange) {
+		return nil, newError(LimitError, "", "%v is too large", s)
+	}
+	if v, err = tryFloatString(s); err == nil {
+		return v, nil
+	} else if errors.Is(err, strconv.ErrRange) {
+		return nil, newError(LimitError, "", "%v is too large", s)
+	}
+	return nil, newError(SyntaxError, "", "%v is not a number", s)
 }